@@ -3,14 +3,10 @@ package main
 import (
 	"fmt"
 	"github.com/FactomProject/FactomCode/common"
-	"github.com/FactomProject/factoid"
 	"github.com/FactomProject/factoid/block"
-	"github.com/FactomProject/factom"
-	"github.com/FactomProject/fctwallet/Wallet"
 	"log"
 	"runtime"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -29,56 +25,10 @@ func Log(format string, args ...interface{}) {
 	fmt.Printf(file+":"+strconv.Itoa(line)+" - "+format+"\n", args...)
 }
 
-func GetAddressInformationFromFactom(address string) (*Address, error) {
-	answer := new(Address)
-	answer.Address = address
-
-	invalid := 0 //to count how many times we got "invalid address"
-
-	ecBalance, err := Wallet.ECBalance(address)
-	fmt.Printf("ECBalance - %v, %v\n\n", ecBalance, err)
-	if err != nil {
-		if err.Error() != "Invalid EC Address" && !strings.Contains(err.Error(), "encoding/hex") {
-			return nil, err
-		}
-		invalid++
-	} else {
-		answer.Balance = fmt.Sprintf("%d", ecBalance)
-		answer.AddressType = "EC Address"
-		if ecBalance > 0 {
-			return answer, nil
-		}
-	}
-	fctBalance, err := Wallet.FactoidBalance(address)
-	fmt.Printf("FactoidBalance - %v, %v\n\n", fctBalance, err)
-	if err != nil {
-		if err.Error() != "Invalid Factoid Address" {
-			return nil, err
-		}
-		invalid++
-	} else {
-		answer.AddressType = "Factoid Address"
-		if fctBalance > 0 {
-			answer.Balance = factoid.ConvertDecimalToString(uint64(fctBalance))
-			return answer, nil
-		}
-	}
-	if invalid > 1 {
-		//2 responses - it's not a valid address period
-		return nil, fmt.Errorf("Invalid address")
-	}
-	if invalid == 0 {
-		//no invalid responses - meaning it's a public key valid for both factoid and ec
-		answer.AddressType = "Unknown Address"
-	}
-
-	return answer, nil
-}
-
 func GetDBlockFromFactom(keyMR string) (*DBlock, error) {
 	answer := new(DBlock)
 
-	body, err := factom.GetDBlock(keyMR)
+	body, err := Node.GetDBlock(keyMR)
 	if err != nil {
 		return answer, err
 	}
@@ -116,46 +66,121 @@ func ProcessBlocks() error {
 	if err != nil {
 		return err
 	}
+	if previousBlock == nil {
+		return rewindToStoredDBlock(dataStatus, dataStatus.DBlockHeight)
+	}
 	for {
 		block := previousBlock
 		log.Printf("Processing dblock %v\n", block.KeyMR)
 		toProcess = block.PrevBlockKeyMR
 		if toProcess == "0000000000000000000000000000000000000000000000000000000000000000" || block.KeyMR == dataStatus.LastProcessedBlock {
 			dataStatus.LastProcessedBlock = dataStatus.LastKnownBlock
-			break
+			return SaveDataStatus(dataStatus)
 		}
 		previousBlock, err = LoadDBlock(toProcess)
-
+		if err != nil {
+			return err
+		}
+		if previousBlock == nil {
+			return rewindToStoredDBlock(dataStatus, block.SequenceNumber-1)
+		}
 		if previousBlock.NextBlockKeyMR != "" {
 			continue
 		}
 
-		blockList := block.EntryBlockList[:]
+		blockList := append([]ListEntry{}, block.EntryBlockList...)
 		blockList = append(blockList, block.AdminBlock)
 		blockList = append(blockList, block.EntryCreditBlock)
 		blockList = append(blockList, block.FactoidBlock)
 
+		linkedBlocks := []*Block{}
+		anchors := []*ProcessedAnchor{}
 		for _, v := range blockList {
-			err = ProcessBlock(v.KeyMR)
+			linked, found, err := ProcessBlock(v.KeyMR)
+			if err != nil {
+				return err
+			}
+			linkedBlocks = append(linkedBlocks, linked...)
+			anchors = append(anchors, found...)
+		}
+
+		//The link to the DBlock marks it as processed, so it is stored in the
+		//same batch as everything else processing it changes
+		err = RunInBatch(func() error {
+			for _, v := range linkedBlocks {
+				err := SaveBlock(v)
+				if err != nil {
+					return err
+				}
+			}
+			for _, v := range anchors {
+				err := ProcessAnchorEntry(v.Entry, v.Height, v.VerificationErrors)
+				if err != nil {
+					return err
+				}
+			}
+			//Loaded again, as it can be anchored above
+			prev, err := LoadDBlock(block.PrevBlockKeyMR)
 			if err != nil {
 				return err
 			}
+			if prev == nil {
+				return fmt.Errorf("DBlock %v not found", block.PrevBlockKeyMR)
+			}
+			linked := *prev
+			linked.NextBlockKeyMR = block.KeyMR
+			return SaveDBlock(&linked)
+		})
+		if err != nil {
+			return err
 		}
+	}
+}
 
-		previousBlock.NextBlockKeyMR = block.KeyMR
-		err = SaveDBlock(previousBlock)
+// rewindToStoredDBlock moves the last known block back to the highest stored
+// DBlock below height, where a DBlock is missing - rolled back or deleted by
+// the database check - so the next synchronization fetches it again.
+func rewindToStoredDBlock(dataStatus *DataStatusStruct, height int) error {
+	log.Printf("DBlock at height %v is missing, synchronizing again from below it", height)
+	dataStatus.LastKnownBlock = "0000000000000000000000000000000000000000000000000000000000000000"
+	dataStatus.DBlockHeight = 0
+	for i := height - 1; i >= 0; i-- {
+		stored, err := LoadDBlockBySequence(i)
 		if err != nil {
 			return err
 		}
+		if stored != nil {
+			dataStatus.LastKnownBlock = stored.KeyMR
+			dataStatus.DBlockHeight = stored.SequenceNumber
+			break
+		}
 	}
-	return nil
+	return SaveDataStatus(dataStatus)
 }
 
-func ProcessBlock(keyMR string) error {
+// ProcessedAnchor is an anchor entry found by ProcessBlock, along with the
+// height of the DBlock it was included in and what could not be verified
+// about it.
+type ProcessedAnchor struct {
+	Entry              *Entry
+	Height             int
+	VerificationErrors []string
+}
+
+// ProcessBlock walks back the chain of the block to the last block linked to
+// the next one. It returns the blocks with their links to the next block set
+// and the verified anchor entries of the blocks walked, nothing is saved.
+func ProcessBlock(keyMR string) ([]*Block, []*ProcessedAnchor, error) {
 	log.Printf("ProcessBlock()")
+	linkedBlocks := []*Block{}
+	anchors := []*ProcessedAnchor{}
 	previousBlock, err := LoadBlock(keyMR)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if previousBlock == nil {
+		Log("Block %v is missing, run the database check to refetch it", keyMR)
+		return linkedBlocks, anchors, nil
 	}
 	log.Printf("chain - %v", previousBlock.ChainID)
 
@@ -164,35 +189,42 @@ func ProcessBlock(keyMR string) error {
 		log.Printf("Processing block %v\n", block.PartialHash)
 		toProcess := block.PrevBlockHash
 		if toProcess == "0000000000000000000000000000000000000000000000000000000000000000" {
-			return nil
+			return linkedBlocks, anchors, nil
 		}
 
 		if block.ChainID == AnchorBlockID {
 			for _, v := range block.EntryList {
-				err = ProcessAnchorEntry(v)
-				if err != nil {
-					return err
+				anchor := &ProcessedAnchor{Entry: v, Height: block.DBlockHeight}
+				//Verified here, as the batch keeps the readers waiting
+				if v.AnchorRecord != nil {
+					anchor.VerificationErrors = VerifyAnchor(v)
 				}
+				anchors = append(anchors, anchor)
 			}
 		}
 
 		previousBlock, err = LoadBlock(toProcess)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		if previousBlock.NextBlockHash != "" {
-			return nil
+		if previousBlock == nil {
+			Log("Block %v of chain %v is missing, run the database check to refetch it", toProcess, block.ChainID)
+			return linkedBlocks, anchors, nil
 		}
-		previousBlock.NextBlockHash = block.PartialHash
-		err = SaveBlock(previousBlock)
-		if err != nil {
-			return err
+		if previousBlock.NextBlockHash != "" {
+			return linkedBlocks, anchors, nil
 		}
+		linked := *previousBlock
+		linked.NextBlockHash = block.PartialHash
+		linkedBlocks = append(linkedBlocks, &linked)
 	}
-	return nil
+	return linkedBlocks, anchors, nil
 }
 
-func ProcessAnchorEntry(e *Entry) error {
+// ProcessAnchorEntry records an anchor entry, included in the DBlock at
+// anchorHeight, on the DBlock it anchors. The entry is verified beforehand,
+// as this runs inside the batch.
+func ProcessAnchorEntry(e *Entry, anchorHeight int, verificationErrors []string) error {
 	if e.AnchorRecord == nil {
 		return fmt.Errorf("No anchor record provided")
 	}
@@ -200,116 +232,325 @@ func ProcessAnchorEntry(e *Entry) error {
 	if err != nil {
 		return err
 	}
+	if dBlock == nil {
+		Log("Anchor entry %v anchors unknown DBlock %v", e.Hash, e.AnchorRecord.KeyMR)
+		return nil
+	}
+	dBlockCopy := *dBlock
+	dBlock = &dBlockCopy
 	dBlock.AnchorRecord = e.Hash
 	dBlock.AnchoredInTransaction = e.AnchorRecord.Bitcoin.TXID
+	dBlock.AnchorVerificationErrors = verificationErrors
+	dBlock.AnchorVerified = len(dBlock.AnchorVerificationErrors) == 0
+	anchorDBlock, err := LoadDBlockBySequence(anchorHeight)
+	if err != nil {
+		return err
+	}
+	if anchorDBlock != nil {
+		dBlock.AnchorTimestamp = anchorDBlock.Timestamp
+	}
 	err = SaveDBlock(dBlock)
 	if err != nil {
 		return err
 	}
-	return nil
+	return SaveAnchorTransaction(e.AnchorRecord.Bitcoin.TXID, dBlock.KeyMR)
 }
 
+// Synchronize brings the database up to the node's current head. DBlocks are
+// stored oldest first, each in one transaction together with the DataStatus
+// checkpoint, so an interrupted sync resumes right after the last DBlock it
+// stored.
 func Synchronize() error {
 	log.Println("Synchronize()")
-	head, err := factom.GetDBlockHead()
+	head, err := Node.GetDBlockHead()
 	if err != nil {
 		Log("Error - %v", err)
 		return err
 	}
-	previousKeyMR := head.KeyMR
 	dataStatus := LoadDataStatus()
-	maxHeight := dataStatus.DBlockHeight
-	for {
-
-		block, err := LoadDBlock(previousKeyMR)
+	toSync, err := CheckForReorg(head.KeyMR, dataStatus)
+	if err != nil {
+		Log("Error - %v", err)
+		return err
+	}
+	if dataStatus.HaltedAt != "" {
+		//Verification is deterministic, retrying the same DBlock cannot help
+		if len(toSync) > 0 && toSync[len(toSync)-1].KeyMR == dataStatus.HaltedAt {
+			log.Printf("Synchronization halted at dblock %v, which failed verification", dataStatus.HaltedAt)
+			return nil
+		}
+		log.Printf("The node's chain no longer leads through dblock %v, resuming synchronization", dataStatus.HaltedAt)
+		dataStatus.HaltedAt = ""
+		err = SaveDataStatus(dataStatus)
 		if err != nil {
 			Log("Error - %v", err)
 			return err
 		}
+	}
+	if len(toSync) == 0 {
+		return nil
+	}
 
-		if block != nil {
-			if maxHeight < block.SequenceNumber {
-				maxHeight = block.SequenceNumber
-			}
-			if previousKeyMR == dataStatus.LastKnownBlock {
-				dataStatus.LastKnownBlock = head.KeyMR
-				dataStatus.DBlockHeight = maxHeight
-				break
-			} else {
-				previousKeyMR = block.PrevBlockKeyMR
-				continue
+	Progress.Start(dataStatus.DBlockHeight, toSync[0].SequenceNumber)
+	defer Progress.Finish()
+
+	for i := len(toSync) - 1; i >= 0; i-- {
+		body := toSync[i]
+		//Everything derived from the DBlock is committed together with the checkpoint
+		err = SynchronizeDBlock(body, func() error {
+			dataStatus.LastKnownBlock = body.KeyMR
+			if dataStatus.DBlockHeight < body.SequenceNumber {
+				dataStatus.DBlockHeight = body.SequenceNumber
 			}
-		}
-		body, err := GetDBlockFromFactom(previousKeyMR)
+			return SaveDataStatus(dataStatus)
+		})
 		if err != nil {
 			Log("Error - %v", err)
+			if verificationErr, ok := err.(*VerificationError); ok {
+				qErr := RunInBatch(func() error {
+					return QuarantineBlocks(verificationErr.DBlockKeyMR, verificationErr.Blocks, LoadDataStatus())
+				})
+				if qErr != nil {
+					Log("Error - %v", qErr)
+				}
+			}
 			return err
 		}
 
-		log.Printf("\n\nProcessing dblock number %v\n", body.SequenceNumber)
+		Progress.Update(body.SequenceNumber)
+	}
+	return nil
+}
 
-		str, err := EncodeJSONString(body)
+// CollectDBlocksToSync walks back from the head to the last synchronized
+// DBlock and returns the headers of every DBlock in between, newest first.
+// The walk also stops at the first DBlock at or below minHeight, -1 for no
+// limit, which is returned separately - nil if the walk was not stopped by it.
+func CollectDBlocksToSync(headKeyMR, lastKnownBlock string, minHeight int) ([]*DBlock, *DBlock, error) {
+	answer := []*DBlock{}
+	previousKeyMR := headKeyMR
+	for previousKeyMR != lastKnownBlock && IsHashZeroes(previousKeyMR) == false {
+		block, err := loadOrFetchDBlock(previousKeyMR)
 		if err != nil {
-			Log("Error - %v", err)
-			return err
+			return nil, nil, err
+		}
+		if block.SequenceNumber <= minHeight {
+			return answer, block, nil
+		}
+		answer = append(answer, block)
+		if len(answer)%1000 == 0 {
+			log.Printf("Collected %v dblock headers, at height %v", len(answer), block.SequenceNumber)
+		}
+		previousKeyMR = block.PrevBlockKeyMR
+	}
+	return answer, nil, nil
+}
+
+// SynchronizeDBlock fetches and verifies every block referenced by the
+// DBlock, then stores them and the DBlock itself in one batch, along with
+// the writes of then if it is not nil. DBlocks already stored by an
+// interrupted sync are left alone, only then is run.
+func SynchronizeDBlock(body *DBlock, then func() error) error {
+	stored, err := LoadDBlock(body.KeyMR)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		if then == nil {
+			return nil
 		}
-		log.Printf("%v", str)
+		return RunInBatch(then)
+	}
+	return synchronizeDBlock(body, then)
+}
+
+// synchronizeDBlock stores the DBlock whether it is stored already or not.
+// Blocks that are stored already are saved again, blocks that are missing are
+// saved along with everything derived from them. Nothing is fetched inside
+// the batch.
+func synchronizeDBlock(body *DBlock, then func() error) error {
+	log.Printf("\n\nProcessing dblock number %v\n", body.SequenceNumber)
 
-		for _, v := range body.EntryBlockList {
-			fetchedBlock, err := FetchBlock(v.ChainID, v.KeyMR, body.BlockTimeStr)
+	str, err := EncodeJSONString(body)
+	if err != nil {
+		return err
+	}
+	log.Printf("%v", str)
+
+	//The marshalled DBlock is fetched along with its blocks
+	fetchedBlocks := make([]*Block, len(body.EntryBlockList))
+	err = Fetcher.Run(len(body.EntryBlockList)+1, func(i int) error {
+		if i == len(body.EntryBlockList) {
+			raw, err := Fetcher.GetRaw(body.KeyMR)
 			if err != nil {
-				Log("Error - %v", err)
 				return err
 			}
-			switch v.ChainID {
-			case "000000000000000000000000000000000000000000000000000000000000000a":
-				body.AdminEntries += fetchedBlock.EntryCount
-				body.AdminBlock = ListEntry{ChainID: v.ChainID, KeyMR: v.KeyMR}
-				break
-			case "000000000000000000000000000000000000000000000000000000000000000c":
-				body.EntryCreditEntries += fetchedBlock.EntryCount
-				body.EntryCreditBlock = ListEntry{ChainID: v.ChainID, KeyMR: v.KeyMR}
-				break
-			case "000000000000000000000000000000000000000000000000000000000000000f":
-				body.FactoidEntries += fetchedBlock.EntryCount
-				body.FactoidBlock = ListEntry{ChainID: v.ChainID, KeyMR: v.KeyMR}
-				break
-			default:
-				body.EntryEntries += fetchedBlock.EntryCount
-				break
-			}
+			body.BinaryString = fmt.Sprintf("%x", raw)
+			return nil
 		}
-		body.EntryBlockList = body.EntryBlockList[3:]
+		v := body.EntryBlockList[i]
+		block, err := FetchAndParseBlock(v.ChainID, v.KeyMR, body.BlockTimeStr)
+		if err != nil {
+			return err
+		}
+		fetchedBlocks[i] = block
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//Nothing gets saved unless everything checks out
+	quarantined, err := VerifyDBlock(body, fetchedBlocks)
+	if err != nil {
+		return err
+	}
+	if len(quarantined) > 0 {
+		return &VerificationError{DBlockKeyMR: body.KeyMR, Blocks: quarantined}
+	}
 
-		err = SaveDBlock(body)
+	return RunInBatch(func() error {
+		err := saveSynchronizedDBlock(body, fetchedBlocks)
 		if err != nil {
-			Log("Error - %v", err)
 			return err
 		}
+		if then == nil {
+			return nil
+		}
+		return then()
+	})
+}
 
-		if maxHeight < body.SequenceNumber {
-			maxHeight = body.SequenceNumber
+// saveSynchronizedDBlock stores the verified blocks of a DBlock, everything
+// derived from them and the DBlock itself.
+func saveSynchronizedDBlock(body *DBlock, fetchedBlocks []*Block) error {
+	//Blocks are saved in DBlock order no matter in which order they were fetched
+	for i, v := range body.EntryBlockList {
+		fetchedBlock := fetchedBlocks[i]
+		fetchedBlock.DBlockHeight = body.SequenceNumber
+
+		//A block saved by an interrupted sync is already counted in its chain
+		existing, err := LoadBlock(v.KeyMR)
+		if err != nil {
+			return err
 		}
-		previousKeyMR = body.PrevBlockKeyMR
-		if previousKeyMR == "0000000000000000000000000000000000000000000000000000000000000000" {
-			dataStatus.LastKnownBlock = head.KeyMR
-			dataStatus.DBlockHeight = maxHeight
-			break
+		err = SaveBlock(fetchedBlock)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			err = advanceChainHead(fetchedBlock)
+			if err != nil {
+				return err
+			}
+			if fetchedBlock.IsEntryBlock {
+				err = UpdateChainStats(fetchedBlock)
+				if err != nil {
+					return err
+				}
+			}
 		}
 
+		//Indexes are keyed by what they index, so the ones of a stored block
+		//are rebuilt in place - the database check refetches DBlocks to repair them
+		if fetchedBlock.IsEntryBlock {
+			err = IndexBlockText(fetchedBlock)
+			if err != nil {
+				return err
+			}
+			err = IndexBlockExternalIDs(fetchedBlock)
+			if err != nil {
+				return err
+			}
+		}
+		if fetchedBlock.IsFactoidBlock {
+			err = SaveFactoidBlockTransactions(fetchedBlock)
+			if err != nil {
+				return err
+			}
+		}
+		if fetchedBlock.IsEntryCreditBlock {
+			err = IndexBlockCommits(fetchedBlock)
+			if err != nil {
+				return err
+			}
+		}
+		if fetchedBlock.IsAdminBlock {
+			err = IndexBlockAdminEvents(fetchedBlock)
+			if err != nil {
+				return err
+			}
+		}
+		if fetchedBlock.IsFactoidBlock || fetchedBlock.IsEntryCreditBlock {
+			err = IndexBlockAddresses(fetchedBlock)
+			if err != nil {
+				return err
+			}
+		}
+		switch v.ChainID {
+		case "000000000000000000000000000000000000000000000000000000000000000a":
+			body.AdminEntries += fetchedBlock.EntryCount
+			body.AdminBlock = ListEntry{ChainID: v.ChainID, KeyMR: v.KeyMR}
+			break
+		case "000000000000000000000000000000000000000000000000000000000000000c":
+			body.EntryCreditEntries += fetchedBlock.EntryCount
+			body.EntryCreditBlock = ListEntry{ChainID: v.ChainID, KeyMR: v.KeyMR}
+			break
+		case "000000000000000000000000000000000000000000000000000000000000000f":
+			body.FactoidEntries += fetchedBlock.EntryCount
+			body.FactoidBlock = ListEntry{ChainID: v.ChainID, KeyMR: v.KeyMR}
+			break
+		default:
+			body.EntryEntries += fetchedBlock.EntryCount
+			break
+		}
 	}
-	err = SaveDataStatus(dataStatus)
+	body.EntryBlockList = body.EntryBlockList[3:]
+
+	return SaveDBlock(body)
+}
+
+// advanceChainHead makes the block the head of its chain, unless the chain
+// already has a newer one - the database check refetches missing blocks
+// below the head.
+func advanceChainHead(block *Block) error {
+	head, err := LoadChainHead(block.ChainID)
 	if err != nil {
-		Log("Error - %v", err)
 		return err
 	}
-	return nil
+	if head != "" {
+		headBlock, err := LoadBlock(head)
+		if err != nil {
+			return err
+		}
+		if headBlock != nil && headBlock.DBlockHeight > block.DBlockHeight {
+			return nil
+		}
+	}
+	return SaveChainHead(block.ChainID, block.PartialHash)
 }
 
 func FetchBlock(chainID, hash, blockTime string) (*Block, error) {
+	block, err := FetchAndParseBlock(chainID, hash, blockTime)
+	if err != nil {
+		return nil, err
+	}
+
+	err = SaveBlock(block)
+	if err != nil {
+		Log("Error - %v", err)
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// FetchAndParseBlock fetches and parses a block without saving it, so it
+// can safely run alongside other fetches.
+func FetchAndParseBlock(chainID, hash, blockTime string) (*Block, error) {
 	block := new(Block)
 
-	raw, err := factom.GetRaw(hash)
+	raw, err := Fetcher.GetRaw(hash)
 	if err != nil {
 		Log("Error - %v", err)
 		return nil, err
@@ -345,12 +586,6 @@ func FetchBlock(chainID, hash, blockTime string) (*Block, error) {
 		break
 	}
 
-	err = SaveBlock(block)
-	if err != nil {
-		Log("Error - %v", err)
-		return nil, err
-	}
-
 	return block, nil
 }
 
@@ -364,6 +599,7 @@ func ParseEntryCreditBlock(chainID, hash string, rawBlock []byte, blockTime stri
 	}
 
 	answer.ChainID = chainID
+	answer.Timestamp = blockTime
 	h, err := ecBlock.Hash()
 	if err != nil {
 		return nil, err
@@ -403,8 +639,15 @@ func ParseEntryCreditBlock(chainID, hash string, rawBlock []byte, blockTime stri
 		entry.SpewString = v.Spew()
 		entry.ShortEntry = v.Interpret()
 
+		entry.ECEntry, err = ParseECEntry(v)
+		if err != nil {
+			return nil, err
+		}
+
 		answer.EntryList[i] = entry
 	}
+	ApplyECMinuteMarkers(answer)
+	UpdateECTotals(answer)
 
 	answer.JSONString, err = ecBlock.JSONString()
 	if err != nil {
@@ -507,6 +750,28 @@ func ParseEntryBlock(chainID, hash string, rawBlock []byte, blockTime string) (*
 	}
 
 	Log("Block - %v", answer.JSONString)
+
+	//Entries are fetched in parallel, minute markers are applied once they are all in
+	entryHashes := []string{}
+	for _, v := range eBlock.Body.EBEntries {
+		if IsMinuteMarker(v.String()) == false {
+			entryHashes = append(entryHashes, v.String())
+		}
+	}
+	entries := make([]*Entry, len(entryHashes))
+	err = Fetcher.Run(len(entryHashes), func(i int) error {
+		entry, err := FetchAndParseEntry(entryHashes[i], blockTime, IsHashZeroes(answer.PrevBlockHash) && i == 0)
+		if err != nil {
+			return err
+		}
+		entries[i] = entry
+		return nil
+	})
+	if err != nil {
+		Log("Error - %v", err)
+		return nil, err
+	}
+
 	lastMinuteMarkedEntry := 0
 	for _, v := range eBlock.Body.EBEntries {
 		if IsMinuteMarker(v.String()) {
@@ -515,13 +780,9 @@ func ParseEntryBlock(chainID, hash string, rawBlock []byte, blockTime string) (*
 			}
 			lastMinuteMarkedEntry = len(answer.EntryList)
 		} else {
-			entry, err := FetchAndParseEntry(v.String(), blockTime, IsHashZeroes(answer.PrevBlockHash) && answer.EntryCount == 0)
-			if err != nil {
-				Log("Error - %v", err)
-				return nil, err
-			}
+			entries[answer.EntryCount].EntryBlock = answer.PartialHash
+			answer.EntryList = append(answer.EntryList, entries[answer.EntryCount])
 			answer.EntryCount++
-			answer.EntryList = append(answer.EntryList, entry)
 		}
 	}
 	answer.SpewString = eBlock.Spew()
@@ -545,7 +806,7 @@ func IsMinuteMarker(hash string) bool {
 
 func FetchAndParseEntry(hash, blockTime string, isFirstEntry bool) (*Entry, error) {
 	e := new(Entry)
-	raw, err := factom.GetRaw(hash)
+	raw, err := Fetcher.GetRaw(hash)
 	if err != nil {
 		Log("Error - %v", err)
 		return nil, err
@@ -589,12 +850,7 @@ func FetchAndParseEntry(hash, blockTime string, isFirstEntry bool) (*Entry, erro
 		}
 	}
 
-	err = SaveEntry(e)
-	if err != nil {
-		Log("Error - %v", err)
-		return nil, err
-	}
-
+	//Entries are saved along with their block in SaveBlock
 	return e, nil
 }
 
@@ -671,6 +927,11 @@ func ParseAdminBlock(chainID, hash string, rawBlock []byte, blockTime string) (*
 		entry.SpewString = v.Spew()
 		entry.ShortEntry = v.Interpret()
 
+		entry.AdminEntry, err = ParseAdminEntry(v.Type(), marshalled)
+		if err != nil {
+			return nil, err
+		}
+
 		answer.EntryList[i] = entry
 
 	}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCollectDBlocksToSync(t *testing.T) {
+	fc := NewFixtureClient()
+	resetTestData(fc)
+
+	addFixtureDBlock(fc, "a0", zeroHash, 0)
+	addFixtureDBlock(fc, "a1", "a0", 1)
+	addFixtureDBlock(fc, "a2", "a1", 2)
+	addFixtureDBlock(fc, "a3", "a2", 3)
+
+	blocks, _, err := CollectDBlocksToSync("a3", zeroHash, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 {
+		t.Fatalf("Expected 4 dblocks, got %v", len(blocks))
+	}
+	for i, v := range blocks {
+		if v.SequenceNumber != 3-i {
+			t.Errorf("DBlock %v has height %v, expected %v", i, v.SequenceNumber, 3-i)
+		}
+	}
+
+	blocks, _, err = CollectDBlocksToSync("a3", "a1", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[1].KeyMR != "a2" {
+		t.Errorf("Expected only a3 and a2 to be synchronized - %v", blocks)
+	}
+
+	blocks, _, err = CollectDBlocksToSync("a3", "a3", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 0 {
+		t.Errorf("Expected nothing to synchronize - %v", blocks)
+	}
+}
+
+func TestSyncProgress(t *testing.T) {
+	tracker := new(ProgressTracker)
+	tracker.Start(10, 20)
+	tracker.Update(15)
+	p := tracker.Get()
+	if p.Syncing == false {
+		t.Errorf("Tracker should be syncing")
+	}
+	if p.Percent() != 50 {
+		t.Errorf("Expected 50%%, got %v", p.Percent())
+	}
+	tracker.Finish()
+	if tracker.Get().Syncing == true {
+		t.Errorf("Tracker should be done syncing")
+	}
+}
+
+func TestSynchronizeHalted(t *testing.T) {
+	fc := NewFixtureClient()
+	resetTestData(fc)
+
+	saveTestDBlock(t, "a0", zeroHash, 0)
+	ds := LoadDataStatus()
+	ds.LastKnownBlock = "a0"
+	ds.HaltedAt = "a1"
+	err := SaveDataStatus(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addFixtureDBlock(fc, "a0", zeroHash, 0)
+	addFixtureDBlock(fc, "a1", "a0", 1)
+	addFixtureDBlock(fc, "a2", "a1", 2)
+	fc.SetHead("a2")
+
+	err = Synchronize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if LoadDataStatus().HaltedAt != "a1" {
+		t.Errorf("Synchronization did not stay halted")
+	}
+	block, err := LoadDBlock("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block != nil {
+		t.Errorf("DBlock synchronized past the halt")
+	}
+
+	//The node moves to a chain that does not lead through the failed DBlock
+	addFixtureDBlock(fc, "b1", "a0", 1)
+	fc.SetHead("b1")
+	Synchronize()
+	if LoadDataStatus().HaltedAt != "" {
+		t.Errorf("Synchronization still halted - %v", LoadDataStatus().HaltedAt)
+	}
+}
+
+func TestProcessBlocksMissingDBlock(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	saveTestDBlock(t, "a0", zeroHash, 0)
+	saveTestDBlock(t, "a2", "a1", 2)
+	ds := LoadDataStatus()
+	ds.LastKnownBlock = "a2"
+	ds.LastProcessedBlock = "a0"
+	ds.DBlockHeight = 2
+	err := SaveDataStatus(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ProcessBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds = LoadDataStatus()
+	if ds.LastKnownBlock != "a0" || ds.DBlockHeight != 0 {
+		t.Errorf("Synchronization was not rewound below the missing DBlock - %v, %v", ds.LastKnownBlock, ds.DBlockHeight)
+	}
+}
+
+func TestSaveSynchronizedDBlockAgain(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	chainID := bytes.Repeat([]byte{0x11}, 32)
+	block := testEBlock(chainID, make([]byte, 32), []byte{0x00, 0x01})
+	block.EntryList[0].Content = &DecodedString{Decoded: "hello"}
+	blocks := []*Block{}
+	for _, v := range []string{"0a", "0c", "0f"} {
+		b := new(Block)
+		b.ChainID = zeroHash[:62] + v
+		b.PartialHash = "b" + v
+		b.FullHash = "fb" + v
+		blocks = append(blocks, b)
+	}
+	blocks = append(blocks, block)
+	save := func() {
+		body := testDBlock(zeroHash, 0, blocks...)
+		err := RunInBatch(func() error {
+			return saveSynchronizedDBlock(body, blocks)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	save()
+
+	//A refetch of the stored DBlock rebuilds its indexes without counting its blocks again
+	err := UnindexBlockText(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	save()
+	postings, _, err := LoadTextPostings("hello", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(postings) != 1 || postings[0].Hash != block.EntryList[0].Hash {
+		t.Errorf("Text index was not rebuilt - %v", postings)
+	}
+	chain, err := LoadChain(block.ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.EntryBlockCount != 1 {
+		t.Errorf("Refetched block was counted again - %v", chain.EntryBlockCount)
+	}
+}
+
+func TestProcessBlocks(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	chainID := zeroHash[:62] + "0a"
+	for i, prev := range []string{zeroHash, "b0"} {
+		block := new(Block)
+		block.ChainID = chainID
+		block.PartialHash = fmt.Sprintf("b%v", i)
+		block.FullHash = "f" + block.PartialHash
+		block.PrevBlockHash = prev
+		err := SaveBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dBlock := new(DBlock)
+		dBlock.KeyMR = fmt.Sprintf("a%v", i)
+		dBlock.PrevBlockKeyMR = zeroHash
+		if i > 0 {
+			dBlock.PrevBlockKeyMR = "a0"
+		}
+		dBlock.SequenceNumber = i
+		dBlock.AdminBlock = ListEntry{ChainID: chainID, KeyMR: block.PartialHash}
+		err = SaveDBlock(dBlock)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds := LoadDataStatus()
+	ds.LastKnownBlock = "a1"
+	ds.DBlockHeight = 1
+	err := SaveDataStatus(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ProcessBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dBlock, err := LoadDBlock("a0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dBlock.NextBlockKeyMR != "a1" {
+		t.Errorf("DBlock was not linked - %v", dBlock.NextBlockKeyMR)
+	}
+	block, err := LoadBlock("b0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.NextBlockHash != "b1" {
+		t.Errorf("Block was not linked - %v", block.NextBlockHash)
+	}
+	if LoadDataStatus().LastProcessedBlock != "a1" {
+		t.Errorf("DBlocks were not processed - %v", LoadDataStatus().LastProcessedBlock)
+	}
+}
@@ -0,0 +1,451 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/FactomProject/btcutil/base58"
+	"github.com/FactomProject/factoid"
+)
+
+const AddressTypeFactoid string = "Factoid Address"
+const AddressTypeEC string = "EC Address"
+const AddressTypeFactoidPrivate string = "Factoid Private Key"
+const AddressTypeECPrivate string = "EC Private Key"
+
+// addressPrefixes are the two bytes that make human readable addresses start
+// with FA, EC, Fs and Es.
+var addressPrefixes map[string][]byte = map[string][]byte{
+	AddressTypeFactoid:        []byte{0x5f, 0xb1},
+	AddressTypeEC:             []byte{0x59, 0x2a},
+	AddressTypeFactoidPrivate: []byte{0x64, 0x78},
+	AddressTypeECPrivate:      []byte{0x5d, 0xb6},
+}
+
+// ErrInvalidAddress and ErrInvalidAddressChecksum are returned by ParseAddress
+// for strings that are not addresses or private keys.
+var ErrInvalidAddress error = errors.New("Invalid address")
+var ErrInvalidAddressChecksum error = errors.New("Invalid address checksum")
+
+// IsPrivateKeyType reports whether an address type returned by ParseAddress
+// is a private key rather than an address.
+func IsPrivateKeyType(addressType string) bool {
+	return addressType == AddressTypeFactoidPrivate || addressType == AddressTypeECPrivate
+}
+
+// IsPrivateKey reports whether s is a valid Factoid or EC private key.
+func IsPrivateKey(s string) bool {
+	addressType, _, err := ParseAddress(s)
+	return err == nil && IsPrivateKeyType(addressType)
+}
+
+// ParseAddress validates a human readable address or private key and returns
+// its type along with the key it encodes - the RCD hash of a Factoid
+// address, the public key of an EC address or the private key itself.
+func ParseAddress(address string) (string, []byte, error) {
+	raw := base58.Decode(address)
+	if len(raw) != 38 {
+		return "", nil, ErrInvalidAddress
+	}
+
+	addressType := ""
+	for k, v := range addressPrefixes {
+		if bytes.Equal(raw[:2], v) {
+			addressType = k
+		}
+	}
+	if addressType == "" {
+		return "", nil, ErrInvalidAddress
+	}
+
+	sha := sha256.Sum256(raw[:34])
+	checksum := sha256.Sum256(sha[:])
+	if bytes.Equal(raw[34:], checksum[:4]) == false {
+		return "", nil, ErrInvalidAddressChecksum
+	}
+	return addressType, raw[2:34], nil
+}
+
+// AddressTransaction is one change to the balance of an address.
+type AddressTransaction struct {
+	//Factoid transaction ID, or the entry hash for entry credit commits
+	TxID string
+	Type string
+
+	//Factoid or entry credit block the change comes from
+	Block        string
+	DBlockHeight int
+	Timestamp    string
+
+	//Factoshis for Factoid addresses, entry credits for EC addresses
+	Amount  int64
+	Balance int64
+}
+
+const AddressTransactionFactoid string = "Factoid Transaction"
+const AddressTransactionECPurchase string = "Entry Credit Purchase"
+const AddressTransactionChainCommit string = "Chain Commit"
+const AddressTransactionEntryCommit string = "Entry Commit"
+
+func (t *AddressTransaction) IsFactoid() bool {
+	return t.Type == AddressTransactionFactoid
+}
+
+func (t *AddressTransaction) AmountString() string {
+	return formatAddressAmount(t.Amount, t.IsFactoid())
+}
+
+func (t *AddressTransaction) BalanceString() string {
+	return formatAddressAmount(t.Balance, t.IsFactoid())
+}
+
+func formatAddressAmount(amount int64, factoshis bool) string {
+	if factoshis == false {
+		return fmt.Sprintf("%d", amount)
+	}
+	if amount < 0 {
+		return "-" + factoid.ConvertDecimalToString(uint64(-amount))
+	}
+	return factoid.ConvertDecimalToString(uint64(amount))
+}
+
+// addressChange is a balance change not yet added to the index.
+type addressChange struct {
+	Address string
+	Tx      AddressTransaction
+}
+
+// FactoidBlockAddressChanges lists how every transaction of a Factoid block
+// changed the balances of the Factoid addresses it touched.
+func FactoidBlockAddressChanges(b *Block) ([]addressChange, error) {
+	txs, err := ParseFactoidBlockTransactions(b)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := []addressChange{}
+	for _, tx := range txs {
+		//An address can be both an input and an output of the same transaction
+		amounts := map[string]int64{}
+		order := []string{}
+		add := func(address string, amount int64) {
+			if _, found := amounts[address]; found == false {
+				order = append(order, address)
+			}
+			amounts[address] += amount
+		}
+		for _, v := range tx.Inputs {
+			add(v.Address, -int64(v.Amount))
+		}
+		for _, v := range tx.Outputs {
+			add(v.Address, int64(v.Amount))
+		}
+
+		for _, address := range order {
+			answer = append(answer, addressChange{Address: address, Tx: AddressTransaction{
+				TxID:         tx.TxID,
+				Type:         AddressTransactionFactoid,
+				Block:        b.PartialHash,
+				DBlockHeight: b.DBlockHeight,
+				Timestamp:    tx.Timestamp,
+				Amount:       amounts[address],
+			}})
+		}
+	}
+	return answer, nil
+}
+
+// ECBlockAddressChanges lists the entry credit purchases and commits of an
+// entry credit block.
+func ECBlockAddressChanges(b *Block) ([]addressChange, error) {
+	answer := []addressChange{}
+	for _, v := range b.EntryList {
+		if v.ECEntry == nil {
+			continue
+		}
+		tx := AddressTransaction{
+			Block:        b.PartialHash,
+			DBlockHeight: b.DBlockHeight,
+			Timestamp:    b.Timestamp,
+		}
+		switch v.ECEntry.Type {
+		case ECEntryBalanceIncrease:
+			tx.TxID = v.ECEntry.TXID
+			tx.Type = AddressTransactionECPurchase
+			tx.Amount = int64(v.ECEntry.NumEC)
+		case ECEntryChainCommit:
+			tx.TxID = v.ECEntry.EntryHash
+			tx.Type = AddressTransactionChainCommit
+			tx.Amount = -int64(v.ECEntry.Credits)
+		case ECEntryEntryCommit:
+			tx.TxID = v.ECEntry.EntryHash
+			tx.Type = AddressTransactionEntryCommit
+			tx.Amount = -int64(v.ECEntry.Credits)
+		default:
+			continue
+		}
+		answer = append(answer, addressChange{Address: v.ECEntry.ECAddress, Tx: tx})
+	}
+	return answer, nil
+}
+
+func blockAddressChanges(b *Block) ([]addressChange, error) {
+	if b.IsFactoidBlock {
+		return FactoidBlockAddressChanges(b)
+	}
+	if b.IsEntryCreditBlock {
+		return ECBlockAddressChanges(b)
+	}
+	return nil, nil
+}
+
+// addressPrefix starts the index keys of an address.
+func addressPrefix(address string) string {
+	return address + "|"
+}
+
+// addressTransactionKey is the index key of a balance change. Keys sort
+// oldest first by the height of the DBlock the change was included in and
+// then by its position among the changes of its block.
+func addressTransactionKey(address string, height, position int, txID string) string {
+	return fmt.Sprintf("%v%016x|%08x|%v", addressPrefix(address), uint64(height), uint32(position), txID)
+}
+
+// IndexBlockAddresses adds the balance changes of a Factoid or entry credit
+// block to the history of every address involved, one key per change.
+func IndexBlockAddresses(b *Block) error {
+	changes, err := blockAddressChanges(b)
+	if err != nil {
+		return err
+	}
+	return indexAddressChanges(changes)
+}
+
+// indexAddressChanges indexes the changes of a single block.
+func indexAddressChanges(changes []addressChange) error {
+	balances := map[string]int64{}
+	for i, v := range changes {
+		balance, found := balances[v.Address]
+		if found == false {
+			//The balance before the block, the block may be refetched below newer ones
+			limit := fmt.Sprintf("%v%016x|", addressPrefix(v.Address), uint64(v.Tx.DBlockHeight))
+			last, err := loadLastAddressTransaction(v.Address, limit)
+			if err != nil {
+				return err
+			}
+			if last != nil {
+				balance = last.Balance
+			}
+		}
+		tx := v.Tx
+		tx.Balance = balance + tx.Amount
+		balances[v.Address] = tx.Balance
+
+		err := SaveIndexKey(AddressTransactionsBucket, addressTransactionKey(v.Address, tx.DBlockHeight, i, tx.TxID), &tx)
+		if err != nil {
+			return err
+		}
+	}
+	return rebalanceLaterChanges(changes)
+}
+
+// UnindexBlockAddresses removes the balance changes of a Factoid or entry
+// credit block from the address histories.
+func UnindexBlockAddresses(b *Block) error {
+	changes, err := blockAddressChanges(b)
+	if err != nil {
+		return err
+	}
+	return unindexAddressChanges(changes)
+}
+
+// unindexAddressChanges removes the changes of a single block.
+func unindexAddressChanges(changes []addressChange) error {
+	for i, v := range changes {
+		err := DeleteIndexKey(AddressTransactionsBucket, addressTransactionKey(v.Address, v.Tx.DBlockHeight, i, v.Tx.TxID))
+		if err != nil {
+			return err
+		}
+	}
+	return rebalanceLaterChanges(changes)
+}
+
+// rebalanceLaterChanges recomputes the running balances of the changes newer
+// than the block the given changes belong to, for every address involved.
+// Blocks are normally added and removed at the top, where there are none.
+func rebalanceLaterChanges(changes []addressChange) error {
+	done := map[string]bool{}
+	for _, v := range changes {
+		if done[v.Address] == true {
+			continue
+		}
+		done[v.Address] = true
+		err := rebalanceAddress(v.Address, v.Tx.DBlockHeight)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebalanceAddress recomputes the running balances of the changes of an
+// address above the given height.
+func rebalanceAddress(address string, height int) error {
+	//The first key of the next height
+	limit := fmt.Sprintf("%v%016x|", addressPrefix(address), uint64(height)+1)
+
+	//Later changes, newest first
+	keys := []string{}
+	values := [][]byte{}
+	const chunkSize int = 100
+	for start := 0; ; start += chunkSize {
+		chunk, chunkValues, _, err := LoadIndexKeys(AddressTransactionsBucket, addressPrefix(address), start, chunkSize, true)
+		if err != nil {
+			return err
+		}
+		stop := len(chunk) < chunkSize
+		for i, k := range chunk {
+			if k < limit {
+				stop = true
+				break
+			}
+			keys = append(keys, k)
+			values = append(values, chunkValues[i])
+		}
+		if stop == true {
+			break
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	balance := int64(0)
+	last, err := loadLastAddressTransaction(address, limit)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		balance = last.Balance
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		tx := new(AddressTransaction)
+		_, err := DecodeIndexValue(AddressTransactionsBucket, keys[i], values[i], tx)
+		if err != nil {
+			return err
+		}
+		balance += tx.Amount
+		if tx.Balance == balance {
+			continue
+		}
+		tx.Balance = balance
+		err = SaveIndexKey(AddressTransactionsBucket, keys[i], tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadLastAddressTransaction returns the newest balance change of an address
+// with a key sorting before limit, or the newest one of all if limit is empty.
+func loadLastAddressTransaction(address, limit string) (*AddressTransaction, error) {
+	var key string
+	var value []byte
+	if limit == "" {
+		keys, values, _, err := LoadIndexKeys(AddressTransactionsBucket, addressPrefix(address), 0, 1, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return nil, nil
+		}
+		key, value = keys[0], values[0]
+	} else {
+		var err error
+		key, value, err = LoadLastIndexKey(AddressTransactionsBucket, addressPrefix(address), limit)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, nil
+		}
+	}
+
+	tx := new(AddressTransaction)
+	_, err := DecodeIndexValue(AddressTransactionsBucket, key, value, tx)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// GetAddressHistory returns up to max balance changes of an address, newest
+// first, skipping the first start of them, along with their total number.
+func GetAddressHistory(address string, start, max int) ([]*AddressTransaction, int, error) {
+	keys, values, total, err := LoadIndexKeys(AddressTransactionsBucket, addressPrefix(address), start, max, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	answer := []*AddressTransaction{}
+	for i, v := range values {
+		tx := new(AddressTransaction)
+		_, err = DecodeIndexValue(AddressTransactionsBucket, keys[i], v, tx)
+		if err != nil {
+			return nil, 0, err
+		}
+		answer = append(answer, tx)
+	}
+	return answer, total, nil
+}
+
+// GetAddressInformation describes an address from the local index. The
+// balance is the one as of the given DBlock height, or the latest one if the
+// height is negative.
+func GetAddressInformation(address string, height int) (*Address, error) {
+	addressType, key, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := new(Address)
+	answer.AddressType = addressType
+	if IsPrivateKeyType(addressType) {
+		//Never echo private keys back, and they have no history of their own
+		return answer, nil
+	}
+	answer.Address = address
+	answer.PublicKey = fmt.Sprintf("%x", key)
+
+	balance, err := GetAddressBalance(address, height)
+	if err != nil {
+		return nil, err
+	}
+	answer.Balance = formatAddressAmount(balance, addressType == AddressTypeFactoid)
+	return answer, nil
+}
+
+// GetAddressBalance returns the balance of an address as of the given DBlock
+// height, or the latest one if the height is negative. Factoid balances are
+// in factoshis, EC balances in entry credits.
+func GetAddressBalance(address string, height int) (int64, error) {
+	limit := ""
+	if height >= 0 {
+		//The first key of the next height
+		limit = fmt.Sprintf("%v%016x|", addressPrefix(address), uint64(height)+1)
+	}
+	last, err := loadLastAddressTransaction(address, limit)
+	if err != nil {
+		return 0, err
+	}
+	if last == nil {
+		return 0, nil
+	}
+	return last.Balance, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+)
+
+const testFactoidAddress string = "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"
+const testECAddress string = "EC2DKSYyRcNWf7RS963VFYgMExoHRYLHVeCfQ9PGPmNzwrcmgm2r"
+
+func TestParseAddress(t *testing.T) {
+	addressType, key, err := ParseAddress(testFactoidAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addressType != AddressTypeFactoid || len(key) != 32 {
+		t.Errorf("Wrong Factoid address - %v, %x", addressType, key)
+	}
+	addressType, _, err = ParseAddress(testECAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addressType != AddressTypeEC {
+		t.Errorf("Wrong EC address type - %v", addressType)
+	}
+
+	invalid := []string{
+		"",
+		"FA3eNd17NgaXZA3rXQVvzSvWHrpXfHWPzLQjJy2PQVQSc4ZutjC1", //bad checksum
+		"FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1",  //too short
+		"df3ade9eec4b08d5379cc64270c30ea7315d8a8a1a69efe2b98a60ecdd69e604",
+	}
+	for _, v := range invalid {
+		_, _, err = ParseAddress(v)
+		if err == nil {
+			t.Errorf("%v should not be a valid address", v)
+		}
+	}
+
+	if IsPrivateKey("Fs1KWJrpLdfucvmYwN2nWrwepLn8ercpMbzXshd1g8zyhKXLVLWj") == false {
+		t.Errorf("Private key not recognized")
+	}
+	if IsPrivateKey(testFactoidAddress) == true {
+		t.Errorf("Address taken for a private key")
+	}
+}
+
+func TestAddressHistory(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	testAddressHistory(t)
+}
+
+func TestAddressHistoryDatabase(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	defer initTestDatabase(t)()
+	testAddressHistory(t)
+}
+
+func testAddressHistory(t *testing.T) {
+	change := func(address, block, txID string, height int, amount int64) addressChange {
+		return addressChange{Address: address, Tx: AddressTransaction{TxID: txID, Type: AddressTransactionFactoid, Block: block, DBlockHeight: height, Amount: amount}}
+	}
+	err := indexAddressChanges([]addressChange{change(testFactoidAddress, "b1", "t1", 1, 500), change("FA2", "b1", "t1", 1, 300)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = indexAddressChanges([]addressChange{change(testFactoidAddress, "b2", "t2", 3, -200), change(testFactoidAddress, "b2", "t3", 3, 50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, total, err := GetAddressHistory(testFactoidAddress, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(history) != 3 || history[0].TxID != "t3" || history[0].Balance != 350 || history[1].Balance != 300 || history[2].Balance != 500 {
+		t.Errorf("Wrong history - %v", history)
+	}
+	history, total, err = GetAddressHistory(testFactoidAddress, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(history) != 1 || history[0].TxID != "t2" {
+		t.Errorf("Wrong history page - %v", history)
+	}
+
+	balances := map[int]int64{-1: 350, 0: 0, 1: 500, 2: 500, 3: 350, 10: 350}
+	for height, expected := range balances {
+		balance, err := GetAddressBalance(testFactoidAddress, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != expected {
+			t.Errorf("Wrong balance at height %v - %v", height, balance)
+		}
+	}
+
+	//A block added and removed below newer changes moves their balances
+	below := []addressChange{change(testFactoidAddress, "b3", "t4", 2, 100)}
+	err = indexAddressChanges(below)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, _, err = GetAddressHistory(testFactoidAddress, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 || history[0].Balance != 450 || history[1].Balance != 400 || history[2].Balance != 600 {
+		t.Errorf("Wrong balances after a block was added below - %v", history)
+	}
+	err = unindexAddressChanges(below)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, _, err = GetAddressHistory(testFactoidAddress, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Balance != 350 || history[1].Balance != 300 {
+		t.Errorf("Wrong balances after a block was removed below - %v", history)
+	}
+
+	err = unindexAddressChanges([]addressChange{change(testFactoidAddress, "b2", "t2", 3, -200), change(testFactoidAddress, "b2", "t3", 3, 50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := GetAddressInformation(testFactoidAddress, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address.AddressType != AddressTypeFactoid || address.Balance != formatAddressAmount(500, true) {
+		t.Errorf("Wrong address information after rollback - %v", address)
+	}
+
+	if s := formatAddressAmount(-7, false); s != "-7" {
+		t.Errorf("Wrong EC amount - %v", s)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// AdminEntry is a decoded admin block entry. Only the fields relevant to its
+// Type are set.
+type AdminEntry struct {
+	Type   string
+	TypeID int
+
+	//Identity of the server the entry is about
+	IdentityChainID string
+
+	//DB signatures and signing keys
+	PublicKey string
+	Signature string
+
+	//Matryoshka hashes
+	MatryoshkaHash string
+
+	//Server count changes
+	ServerCount int
+
+	//Height at which server and key changes take effect
+	DBHeight int
+
+	//Signing and anchor keys
+	KeyPriority int
+	KeyType     int
+	BTCKeyHash  string
+
+	//Minute numbers
+	Number int
+}
+
+const AdminEntryMinuteNumber string = "Minute Number"
+const AdminEntryDBSignature string = "DB Signature"
+const AdminEntryRevealMatryoshkaHash string = "Reveal Matryoshka Hash"
+const AdminEntryAddMatryoshkaHash string = "Add Matryoshka Hash"
+const AdminEntryIncreaseServerCount string = "Increase Server Count"
+const AdminEntryAddFederatedServer string = "Add Federated Server"
+const AdminEntryAddAuditServer string = "Add Audit Server"
+const AdminEntryRemoveFederatedServer string = "Remove Federated Server"
+const AdminEntryAddSigningKey string = "Add Federated Server Signing Key"
+const AdminEntryAddBTCAnchorKey string = "Add Federated Server Bitcoin Anchor Key"
+const AdminEntryUnknown string = "Unknown"
+
+// adminEntryLayout is how an admin entry type is marshalled - its name and
+// the size of its body, after the type byte.
+type adminEntryLayout struct {
+	Type string
+	Size int
+}
+
+// adminEntryLayouts maps the type IDs of admin entries to their layout. M1
+// admin blocks only carry minute numbers and DB signatures, whose IDs come
+// from the common package that also unmarshals the blocks. The other types
+// are not defined there yet, their IDs and layouts follow the admin block
+// specification:
+//
+//	Minute Number                   number (1)
+//	DB Signature                    identity chain ID (32), public key (32), signature (64)
+//	Reveal/Add Matryoshka Hash      identity chain ID (32), Matryoshka hash (32)
+//	Increase Server Count           amount (1)
+//	Add Federated/Audit Server      identity chain ID (32), DB height (4, big endian)
+//	Remove Federated Server         identity chain ID (32), DB height (4, big endian)
+//	Add Signing Key                 identity chain ID (32), priority (1), public key (32), DB height (4)
+//	Add Bitcoin Anchor Key          identity chain ID (32), priority (1), key type (1), key hash (20)
+var adminEntryLayouts map[byte]adminEntryLayout = map[byte]adminEntryLayout{
+	common.TYPE_MINUTE_NUM:   adminEntryLayout{AdminEntryMinuteNumber, 1},
+	common.TYPE_DB_SIGNATURE: adminEntryLayout{AdminEntryDBSignature, 32 + 32 + 64},
+	2:                        adminEntryLayout{AdminEntryRevealMatryoshkaHash, 32 + 32},
+	3:                        adminEntryLayout{AdminEntryAddMatryoshkaHash, 32 + 32},
+	4:                        adminEntryLayout{AdminEntryIncreaseServerCount, 1},
+	5:                        adminEntryLayout{AdminEntryAddFederatedServer, 32 + 4},
+	6:                        adminEntryLayout{AdminEntryAddAuditServer, 32 + 4},
+	7:                        adminEntryLayout{AdminEntryRemoveFederatedServer, 32 + 4},
+	8:                        adminEntryLayout{AdminEntryAddSigningKey, 32 + 1 + 32 + 4},
+	9:                        adminEntryLayout{AdminEntryAddBTCAnchorKey, 32 + 1 + 1 + 20},
+}
+
+// AdminEventTypes lists the types of the entries listed in the admin history,
+// in the order of their type IDs.
+func AdminEventTypes() []string {
+	answer := []string{}
+	for i := 0; i < 256; i++ {
+		layout, found := adminEntryLayouts[byte(i)]
+		if found == true && layout.Type != AdminEntryMinuteNumber {
+			answer = append(answer, layout.Type)
+		}
+	}
+	return answer
+}
+
+// ParseAdminEntry decodes an admin block entry of the given type from its
+// marshalled form, as returned by the common package. Entry types we do not
+// know about are returned as AdminEntryUnknown.
+func ParseAdminEntry(typeID byte, data []byte) (*AdminEntry, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("Admin entry is empty")
+	}
+	if data[0] != typeID {
+		return nil, fmt.Errorf("Admin entry of type %v is marshalled as type %v", typeID, data[0])
+	}
+
+	answer := new(AdminEntry)
+	answer.TypeID = int(typeID)
+	layout, found := adminEntryLayouts[typeID]
+	if found == false {
+		answer.Type = AdminEntryUnknown
+		return answer, nil
+	}
+	answer.Type = layout.Type
+
+	body := data[1:]
+	if len(body) < layout.Size {
+		return nil, fmt.Errorf("%v admin entry is too short - %v bytes", answer.Type, len(data))
+	}
+
+	switch answer.Type {
+	case AdminEntryMinuteNumber:
+		answer.Number = int(body[0])
+	case AdminEntryDBSignature:
+		answer.IdentityChainID = fmt.Sprintf("%x", body[:32])
+		answer.PublicKey = fmt.Sprintf("%x", body[32:64])
+		answer.Signature = fmt.Sprintf("%x", body[64:128])
+	case AdminEntryRevealMatryoshkaHash, AdminEntryAddMatryoshkaHash:
+		answer.IdentityChainID = fmt.Sprintf("%x", body[:32])
+		answer.MatryoshkaHash = fmt.Sprintf("%x", body[32:64])
+	case AdminEntryIncreaseServerCount:
+		answer.ServerCount = int(body[0])
+	case AdminEntryAddFederatedServer, AdminEntryAddAuditServer, AdminEntryRemoveFederatedServer:
+		answer.IdentityChainID = fmt.Sprintf("%x", body[:32])
+		answer.DBHeight = int(binary.BigEndian.Uint32(body[32:36]))
+	case AdminEntryAddSigningKey:
+		answer.IdentityChainID = fmt.Sprintf("%x", body[:32])
+		answer.KeyPriority = int(body[32])
+		answer.PublicKey = fmt.Sprintf("%x", body[33:65])
+		answer.DBHeight = int(binary.BigEndian.Uint32(body[65:69]))
+	case AdminEntryAddBTCAnchorKey:
+		answer.IdentityChainID = fmt.Sprintf("%x", body[:32])
+		answer.KeyPriority = int(body[32])
+		answer.KeyType = int(body[33])
+		answer.BTCKeyHash = fmt.Sprintf("%x", body[34:54])
+	}
+	return answer, nil
+}
+
+// IsEvent reports whether the entry changes anything worth listing in the
+// admin history. Minute numbers only structure the block.
+func (e *AdminEntry) IsEvent() bool {
+	return e.Type != AdminEntryMinuteNumber
+}
+
+// AdminEvent is an admin entry together with where it was included.
+type AdminEvent struct {
+	DBlockHeight int
+	ABlock       string
+	EntryHash    string
+	Timestamp    string
+
+	*AdminEntry
+}
+
+// adminEventPrefix is the prefix of the admin event index keys of an event
+// type, or of every event if the type is empty.
+func adminEventPrefix(eventType string) string {
+	if eventType == "" {
+		return "*|"
+	}
+	return eventType + "|"
+}
+
+// adminEventKey is the index key of an admin event. Keys sort oldest first by
+// the height of the DBlock the event was included in and then by its position
+// in the admin block.
+func adminEventKey(eventType string, height, position int, entryHash string) string {
+	return fmt.Sprintf("%v%016x|%08x|%v", adminEventPrefix(eventType), uint64(height), uint32(position), entryHash)
+}
+
+// IndexBlockAdminEvents adds the events of an admin block to the admin
+// history, once among every event and once among the events of its type.
+func IndexBlockAdminEvents(b *Block) error {
+	for i, v := range b.EntryList {
+		if v.AdminEntry == nil || v.AdminEntry.IsEvent() == false {
+			continue
+		}
+		event := &AdminEvent{
+			DBlockHeight: b.DBlockHeight,
+			ABlock:       b.PartialHash,
+			EntryHash:    v.Hash,
+			Timestamp:    v.Timestamp,
+			AdminEntry:   v.AdminEntry,
+		}
+		for _, eventType := range []string{"", v.AdminEntry.Type} {
+			err := SaveIndexKey(AdminEventsBucket, adminEventKey(eventType, b.DBlockHeight, i, v.Hash), event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnindexBlockAdminEvents removes the events of an admin block from the admin
+// history.
+func UnindexBlockAdminEvents(b *Block) error {
+	for i, v := range b.EntryList {
+		if v.AdminEntry == nil || v.AdminEntry.IsEvent() == false {
+			continue
+		}
+		for _, eventType := range []string{"", v.AdminEntry.Type} {
+			err := DeleteIndexKey(AdminEventsBucket, adminEventKey(eventType, b.DBlockHeight, i, v.Hash))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetAdminHistory returns up to max admin events, newest first, skipping the
+// first start of them, along with their total number. If eventType is set,
+// only events of that type are returned and counted.
+func GetAdminHistory(eventType string, start, max int) ([]*AdminEvent, int, error) {
+	keys, values, total, err := LoadIndexKeys(AdminEventsBucket, adminEventPrefix(eventType), start, max, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	answer := []*AdminEvent{}
+	for i, v := range values {
+		event := new(AdminEvent)
+		_, err = DecodeIndexValue(AdminEventsBucket, keys[i], v, event)
+		if err != nil {
+			return nil, 0, err
+		}
+		answer = append(answer, event)
+	}
+	return answer, total, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+func TestParseAdminEntry(t *testing.T) {
+	//A DB signature as marshalled in M1 admin blocks
+	data := []byte{common.TYPE_DB_SIGNATURE}
+	data = append(data, bytes.Repeat([]byte{0xaa}, 32)...)
+	data = append(data, bytes.Repeat([]byte{0xbb}, 32)...)
+	data = append(data, bytes.Repeat([]byte{0xcc}, 64)...)
+	entry, err := ParseAdminEntry(data[0], data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != AdminEntryDBSignature {
+		t.Errorf("Wrong type - %v", entry.Type)
+	}
+	if entry.IdentityChainID[:4] != "aaaa" || entry.PublicKey[:4] != "bbbb" || len(entry.Signature) != 128 {
+		t.Errorf("Wrong DB signature - %v", entry)
+	}
+
+	data = []byte{0x05}
+	data = append(data, bytes.Repeat([]byte{0xdd}, 32)...)
+	data = append(data, 0x00, 0x00, 0x01, 0x00)
+	entry, err = ParseAdminEntry(data[0], data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != AdminEntryAddFederatedServer || entry.DBHeight != 256 {
+		t.Errorf("Wrong server change - %v", entry)
+	}
+
+	entry, err = ParseAdminEntry(common.TYPE_MINUTE_NUM, []byte{0x00, 0x03})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != AdminEntryMinuteNumber || entry.Number != 3 || entry.IsEvent() == true {
+		t.Errorf("Wrong minute number - %v", entry)
+	}
+
+	entry, err = ParseAdminEntry(0x7f, []byte{0x7f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != AdminEntryUnknown || entry.TypeID != 0x7f {
+		t.Errorf("Wrong unknown entry - %v", entry)
+	}
+
+	_, err = ParseAdminEntry(common.TYPE_DB_SIGNATURE, []byte{0x01, 0x02})
+	if err == nil {
+		t.Errorf("Expected an error for a short entry")
+	}
+	_, err = ParseAdminEntry(common.TYPE_DB_SIGNATURE, []byte{0x00, 0x03})
+	if err == nil {
+		t.Errorf("Expected an error for an entry marshalled as another type")
+	}
+}
+
+func TestAdminHistory(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	blocks := []*Block{}
+	for i, keyMR := range []string{"a0", "a1"} {
+		block := new(Block)
+		block.ChainID = "000000000000000000000000000000000000000000000000000000000000000a"
+		block.PartialHash = keyMR
+		block.FullHash = "f" + keyMR
+		block.IsAdminBlock = true
+		block.DBlockHeight = i
+		block.EntryList = []*Entry{
+			&Entry{Hash: keyMR + "s", AdminEntry: &AdminEntry{Type: AdminEntryDBSignature}},
+			&Entry{Hash: keyMR + "m", AdminEntry: &AdminEntry{Type: AdminEntryMinuteNumber}},
+		}
+		if i == 1 {
+			block.EntryList = append(block.EntryList, &Entry{Hash: "a1f", AdminEntry: &AdminEntry{Type: AdminEntryAddFederatedServer}})
+		}
+		err := IndexBlockAdminEvents(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	events, total, err := GetAdminHistory("", 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || total != 3 {
+		t.Fatalf("Wrong number of events - %v of %v", len(events), total)
+	}
+	if events[0].EntryHash != "a1f" || events[0].DBlockHeight != 1 || events[2].EntryHash != "a0s" {
+		t.Errorf("Wrong event order - %v, %v", events[0].EntryHash, events[2].EntryHash)
+	}
+
+	events, total, err = GetAdminHistory("", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || total != 3 || events[0].EntryHash != "a1s" {
+		t.Errorf("Wrong page of events - %v of %v", events, total)
+	}
+
+	events, total, err = GetAdminHistory(AdminEntryAddFederatedServer, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || total != 1 || events[0].EntryHash != "a1f" {
+		t.Errorf("Wrong filtered events - %v of %v", events, total)
+	}
+
+	err = UnindexBlockAdminEvents(blocks[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, total, err = GetAdminHistory("", 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || total != 1 || events[0].EntryHash != "a0s" {
+		t.Errorf("Wrong events after unindexing - %v of %v", events, total)
+	}
+	_, total, err = GetAdminHistory(AdminEntryAddFederatedServer, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 {
+		t.Errorf("Filtered events left after unindexing - %v", total)
+	}
+}
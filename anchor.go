@@ -0,0 +1,319 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/FactomProject/ed25519"
+)
+
+// AnchorPublicKey is the hex encoded key anchor records have to be signed with.
+var AnchorPublicKey string
+
+// UnanchoredAge is the number of minutes after which a DBlock that is still
+// not anchored gets reported.
+var UnanchoredAge int
+
+func init() {
+	anchorConfig := ReadConfig().Anchor
+	AnchorPublicKey = anchorConfig.AnchorPublicKey
+	UnanchoredAge = anchorConfig.UnanchoredAge
+}
+
+// VerifyAnchorSignature checks the signature appended to the content of an
+// anchor chain entry against AnchorPublicKey.
+func VerifyAnchorSignature(data string) error {
+	return verifyAnchorSignature(data, AnchorPublicKey)
+}
+
+func verifyAnchorSignature(data, publicKey string) error {
+	if len(data) < 128 {
+		return fmt.Errorf("Data too short")
+	}
+	record := data[:len(data)-128]
+	sig, err := hex.DecodeString(data[len(data)-128:])
+	if err != nil {
+		return fmt.Errorf("Invalid anchor signature - %v", err)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("Invalid anchor signature length %v", len(sig))
+	}
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("Invalid anchor public key %v", publicKey)
+	}
+	pub := new([ed25519.PublicKeySize]byte)
+	copy(pub[:], key)
+	signature := new([ed25519.SignatureSize]byte)
+	copy(signature[:], sig)
+	if ed25519.Verify(pub, []byte(record), signature) == false {
+		return fmt.Errorf("Anchor signature does not match the anchor public key")
+	}
+	return nil
+}
+
+// AnchorOpReturnPrefix starts the data Factom stores in the OP_RETURN output
+// of an anchor transaction. It is followed by the DBlock height on 6 bytes,
+// big endian, and the DBlock KeyMR.
+var AnchorOpReturnPrefix []byte = []byte("Fa")
+
+// DecodeAnchorOpReturn returns the DBlock height and KeyMR anchored in a hex
+// encoded OP_RETURN output script.
+func DecodeAnchorOpReturn(script string) (uint32, string, error) {
+	raw, err := hex.DecodeString(script)
+	if err != nil {
+		return 0, "", fmt.Errorf("Invalid output script - %v", err)
+	}
+	//OP_RETURN followed by a single push of the anchor data
+	size := len(AnchorOpReturnPrefix) + 6 + 32
+	if len(raw) != size+2 || raw[0] != 0x6a || int(raw[1]) != size {
+		return 0, "", fmt.Errorf("Output script is not a Factom anchor")
+	}
+	data := raw[2:]
+	if bytes.Equal(data[:2], AnchorOpReturnPrefix) == false {
+		return 0, "", fmt.Errorf("Output script is not a Factom anchor")
+	}
+	height := uint64(0)
+	for _, v := range data[2:8] {
+		height = height<<8 | uint64(v)
+	}
+	return uint32(height), fmt.Sprintf("%x", data[8:]), nil
+}
+
+// VerifyAnchor checks an anchor entry - its signature, that the DBlock at the
+// anchored height is the anchored one and, if a Bitcoin source is configured,
+// that the Bitcoin transaction is in the Merkle tree of the block it claims
+// and that its OP_RETURN output carries the anchored KeyMR. The Bitcoin block
+// headers are trusted as served by the source. It returns everything that
+// could not be verified.
+func VerifyAnchor(e *Entry) []string {
+	problems := []string{}
+	ar := e.AnchorRecord
+
+	if e.Content == nil {
+		problems = append(problems, "Anchor entry has no content")
+	} else {
+		err := VerifyAnchorSignature(e.Content.Decoded)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	keyMR, err := LoadDBlockKeyMRBySequence(int(ar.DBHeight))
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else if keyMR == "" {
+		problems = append(problems, fmt.Sprintf("No DBlock at the anchored height %v", ar.DBHeight))
+	} else if keyMR != ar.KeyMR {
+		problems = append(problems, fmt.Sprintf("Anchored KeyMR %v does not match DBlock %v at height %v", ar.KeyMR, keyMR, ar.DBHeight))
+	}
+
+	if Bitcoin == nil {
+		problems = append(problems, "No Bitcoin source configured")
+		return problems
+	}
+	tx, err := Bitcoin.GetTransaction(ar.Bitcoin.TXID)
+	if err != nil {
+		problems = append(problems, err.Error())
+		return problems
+	}
+	if tx.BlockHash != ar.Bitcoin.BlockHash {
+		problems = append(problems, fmt.Sprintf("Bitcoin transaction was confirmed in block %v, not %v", tx.BlockHash, ar.Bitcoin.BlockHash))
+	}
+	anchored := false
+	for _, v := range tx.OutputScripts {
+		height, keyMR, err := DecodeAnchorOpReturn(v)
+		if err != nil {
+			continue
+		}
+		anchored = true
+		if keyMR != ar.KeyMR || height != ar.DBHeight {
+			problems = append(problems, fmt.Sprintf("Bitcoin transaction anchors DBlock %v at height %v, not %v at height %v", keyMR, height, ar.KeyMR, ar.DBHeight))
+		}
+	}
+	if anchored == false {
+		problems = append(problems, "Bitcoin transaction has no Factom anchor output")
+	}
+	header, err := Bitcoin.GetBlockHeader(ar.Bitcoin.BlockHash)
+	if err != nil {
+		problems = append(problems, err.Error())
+		return problems
+	}
+	if header.Height != ar.Bitcoin.BlockHeight {
+		problems = append(problems, fmt.Sprintf("Bitcoin block is at height %v, not %v", header.Height, ar.Bitcoin.BlockHeight))
+	}
+	err = tx.VerifyMerkleBranch(header.MerkleRoot)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// AnchorStatus describes how a DBlock was anchored into Bitcoin.
+type AnchorStatus struct {
+	DBlockHeight int
+	DBlockKeyMR  string
+	DBlockTime   string
+
+	//Empty if the DBlock is not anchored yet
+	AnchorRecord       string
+	TXID               string
+	BitcoinBlockHeight int32
+	Verified           bool
+
+	//Seconds between the DBlock and the anchor entry, -1 if not known
+	DelaySeconds int64
+}
+
+// DelayString returns the anchoring delay in a human readable form.
+func (a *AnchorStatus) DelayString() string {
+	if a.DelaySeconds < 0 {
+		return ""
+	}
+	return (time.Duration(a.DelaySeconds) * time.Second).String()
+}
+
+// GetAnchorStatus returns the anchor status of a DBlock.
+func GetAnchorStatus(dBlock *DBlock) (*AnchorStatus, error) {
+	answer := new(AnchorStatus)
+	answer.DBlockHeight = dBlock.SequenceNumber
+	answer.DBlockKeyMR = dBlock.KeyMR
+	answer.DBlockTime = dBlock.BlockTimeStr
+	answer.AnchorRecord = dBlock.AnchorRecord
+	answer.TXID = dBlock.AnchoredInTransaction
+	answer.Verified = dBlock.AnchorVerified
+	answer.DelaySeconds = -1
+	if dBlock.AnchorRecord == "" {
+		return answer, nil
+	}
+
+	if dBlock.AnchorTimestamp >= dBlock.Timestamp && dBlock.Timestamp > 0 {
+		answer.DelaySeconds = int64(dBlock.AnchorTimestamp - dBlock.Timestamp)
+	}
+	entry, err := LoadEntry(dBlock.AnchorRecord)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && entry.AnchorRecord != nil {
+		answer.BitcoinBlockHeight = entry.AnchorRecord.Bitcoin.BlockHeight
+	}
+	return answer, nil
+}
+
+// unanchoredDBlockKey is the key of a DBlock in the index of the DBlocks that
+// are not anchored yet. Keys sort by height.
+func unanchoredDBlockKey(height int, keyMR string) string {
+	return fmt.Sprintf("%016x|%v", uint64(height), keyMR)
+}
+
+// indexDBlockAnchor keeps the DBlock in the index of the unanchored DBlocks for
+// as long as it is not anchored.
+func indexDBlockAnchor(b *DBlock) error {
+	key := unanchoredDBlockKey(b.SequenceNumber, b.KeyMR)
+	if b.AnchorRecord == "" {
+		return SaveIndexKey(UnanchoredDBlocksBucket, key, b.KeyMR)
+	}
+	return DeleteIndexKey(UnanchoredDBlocksBucket, key)
+}
+
+// loadUnanchoredDBlocks returns up to max of the unanchored DBlocks, newest
+// first, skipping the first start of them, along with their total number.
+func loadUnanchoredDBlocks(start, max int) ([]*DBlock, int, error) {
+	keys, values, total, err := LoadIndexKeys(UnanchoredDBlocksBucket, "", start, max, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	answer := []*DBlock{}
+	for i, v := range values {
+		keyMR := new(string)
+		_, err = DecodeIndexValue(UnanchoredDBlocksBucket, keys[i], v, keyMR)
+		if err != nil {
+			return nil, 0, err
+		}
+		dBlock, err := LoadDBlock(*keyMR)
+		if err != nil {
+			return nil, 0, err
+		}
+		if dBlock == nil {
+			continue
+		}
+		answer = append(answer, dBlock)
+	}
+	return answer, total, nil
+}
+
+// GetUnanchoredDBlocks returns up to max of the DBlocks, newest first, that
+// are still not anchored even though they were created more than age ago,
+// skipping the first start of them, along with their total number.
+func GetUnanchoredDBlocks(age time.Duration, now time.Time, start, max int) ([]*DBlock, int, error) {
+	//The newest unanchored DBlocks are usually just not anchored yet
+	recent := 0
+	for {
+		dBlocks, _, err := loadUnanchoredDBlocks(recent, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(dBlocks) == 0 || now.Sub(time.Unix(int64(dBlocks[0].Timestamp), 0)) >= age {
+			break
+		}
+		recent++
+	}
+
+	dBlocks, total, err := loadUnanchoredDBlocks(recent+start, max)
+	if err != nil {
+		return nil, 0, err
+	}
+	return dBlocks, total - recent, nil
+}
+
+// GetAnchorStatuses returns the anchor statuses of a page of DBlocks, newest
+// first, along with the number of pages. If unanchoredOnly is set, only the
+// DBlocks that are not anchored after UnanchoredAge minutes are listed.
+func GetAnchorStatuses(page int, unanchoredOnly bool) ([]*AnchorStatus, int, error) {
+	var dBlocks []*DBlock
+	var pages int
+	if unanchoredOnly == true {
+		var total int
+		var err error
+		dBlocks, total, err = GetUnanchoredDBlocks(time.Duration(UnanchoredAge)*time.Minute, time.Now(), 50*(page-1), 50)
+		if err != nil {
+			return nil, 0, err
+		}
+		pages = (total / 50) + 1
+		if page < 1 || page > pages {
+			return nil, pages, nil
+		}
+	} else {
+		height := GetBlockHeight()
+		pages = ((height + 1) / 50) + 1
+		if page < 1 || page > pages {
+			return nil, pages, nil
+		}
+		max := height - 50*(page-1)
+		start := max - 49
+		if start < 0 {
+			start = 0
+		}
+		var err error
+		dBlocks, err = GetDBlocksReverseOrder(start, max)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	answer := make([]*AnchorStatus, len(dBlocks))
+	for i, v := range dBlocks {
+		var err error
+		answer[i], err = GetAnchorStatus(v)
+		if err != nil {
+			return nil, pages, err
+		}
+	}
+	return answer, pages, nil
+}
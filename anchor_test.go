@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/ed25519"
+)
+
+func TestVerifyAnchor(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := AnchorPublicKey
+	AnchorPublicKey = fmt.Sprintf("%x", pub[:])
+	defer func() { AnchorPublicKey = oldKey }()
+
+	keyMR := "d100000000000000000000000000000000000000000000000000000000000001"
+	saveTestDBlock(t, keyMR, zeroHash, 1)
+	saveTestDBlock(t, "d2", keyMR, 2)
+
+	//The transaction is the second one of its block, next to another one
+	txID := "1100000000000000000000000000000000000000000000000000000000000011"
+	otherTxID := "2200000000000000000000000000000000000000000000000000000000000022"
+	txHash, _ := decodeBitcoinHash(txID)
+	otherTxHash, _ := decodeBitcoinHash(otherTxID)
+	root := sha256Sum(sha256Sum(otherTxHash, txHash))
+	for i, j := 0, len(root)-1; i < j; i, j = i+1, j-1 {
+		root[i], root[j] = root[j], root[i]
+	}
+	merkleRoot := fmt.Sprintf("%x", root)
+
+	record := `{"AnchorRecordVer":1,"DBHeight":1,"KeyMR":"` + keyMR + `"}`
+	entry := new(Entry)
+	entry.Hash = "anchor1"
+	entry.Content = &DecodedString{Decoded: record + fmt.Sprintf("%x", ed25519.Sign(priv, []byte(record))[:])}
+	entry.AnchorRecord = new(AnchorRecord)
+	entry.AnchorRecord.DBHeight = 1
+	entry.AnchorRecord.KeyMR = keyMR
+	entry.AnchorRecord.Bitcoin.TXID = txID
+	entry.AnchorRecord.Bitcoin.BlockHash = "btc1"
+	entry.AnchorRecord.Bitcoin.BlockHeight = 100
+
+	//OP_RETURN, a 40 byte push, "Fa", the height and the KeyMR
+	opReturn := "6a28" + "4661" + "000000000001" + keyMR
+	bc := NewFileBitcoinClient()
+	tx := &BitcoinTransaction{TXID: txID, BlockHash: "btc1", BlockIndex: 1, MerkleBranch: []string{otherTxID}, OutputScripts: []string{"76a914", opReturn}}
+	bc.AddTransaction(tx)
+	bc.AddBlockHeader(&BitcoinBlockHeader{Hash: "btc1", Height: 100, MerkleRoot: merkleRoot})
+	oldBitcoin := Bitcoin
+	Bitcoin = bc
+	defer func() { Bitcoin = oldBitcoin }()
+
+	err = RunInBatch(func() error {
+		return ProcessAnchorEntry(entry, 1, VerifyAnchor(entry))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dBlock, err := LoadDBlock(keyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dBlock.AnchorVerified == false {
+		t.Errorf("Anchor was not verified - %v", dBlock.AnchorVerificationErrors)
+	}
+
+	//A transaction the provider places in the block but is not in its Merkle tree
+	tx.BlockIndex = 0
+	problems := VerifyAnchor(entry)
+	if len(problems) != 1 {
+		t.Errorf("Wrong verification problems - %v", problems)
+	}
+	tx.BlockIndex = 1
+
+	bc.AddBlockHeader(&BitcoinBlockHeader{Hash: "btc1", Height: 101, MerkleRoot: merkleRoot})
+	entry.Content.Decoded = `{"AnchorRecordVer":1,"DBHeight":2,"KeyMR":"` + keyMR + `"}` + entry.Content.Decoded[len(record):]
+	problems = VerifyAnchor(entry)
+	if len(problems) != 2 {
+		t.Errorf("Wrong verification problems - %v", problems)
+	}
+
+	//A record naming the DBlock of another height, with an OP_RETURN that disagrees
+	entry.AnchorRecord.DBHeight = 2
+	problems = VerifyAnchor(entry)
+	if len(problems) != 4 {
+		t.Errorf("Wrong verification problems - %v", problems)
+	}
+
+	Bitcoin = nil
+	entry.AnchorRecord.DBHeight = 1
+	problems = VerifyAnchor(entry)
+	if len(problems) != 2 {
+		t.Errorf("Wrong verification problems - %v", problems)
+	}
+}
+
+func TestDecodeAnchorOpReturn(t *testing.T) {
+	height, keyMR, err := DecodeAnchorOpReturn("6a28466100000000012c" + zeroHash[:62] + "ff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 300 || keyMR != zeroHash[:62]+"ff" {
+		t.Errorf("Wrong anchor - %v, %v", height, keyMR)
+	}
+	for _, v := range []string{"", "6a", "6a284662" + zeroHash[:12] + zeroHash, "76a914" + zeroHash[:40] + "88ac", "zz"} {
+		_, _, err = DecodeAnchorOpReturn(v)
+		if err == nil {
+			t.Errorf("%v should not decode as an anchor", v)
+		}
+	}
+}
+
+func TestAnchorStatuses(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	now := time.Unix(10000, 0)
+	for i, timestamp := range []uint64{1000, 2000, 9900} {
+		block := new(DBlock)
+		block.KeyMR = fmt.Sprintf("d%v", i)
+		block.SequenceNumber = i
+		block.Timestamp = timestamp
+		if i == 0 {
+			block.AnchorRecord = "anchor0"
+			block.AnchoredInTransaction = "tx0"
+			block.AnchorTimestamp = 1600
+		}
+		err := SaveDBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds := LoadDataStatus()
+	ds.DBlockHeight = 2
+	err := SaveDataStatus(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unanchored, total, err := GetUnanchoredDBlocks(time.Hour, now, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unanchored) != 1 || total != 1 || unanchored[0].KeyMR != "d1" {
+		t.Errorf("Wrong unanchored DBlocks - %v of %v", unanchored, total)
+	}
+
+	statuses, pages, err := GetAnchorStatuses(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 1 || len(statuses) != 3 {
+		t.Fatalf("Wrong anchor statuses - %v pages, %v statuses", pages, len(statuses))
+	}
+	if statuses[2].DBlockHeight != 0 || statuses[2].DelaySeconds != 600 || statuses[2].DelayString() != "10m0s" {
+		t.Errorf("Wrong anchor delay - %v", statuses[2])
+	}
+	if statuses[0].AnchorRecord != "" || statuses[0].DelaySeconds != -1 {
+		t.Errorf("Wrong unanchored status - %v", statuses[0])
+	}
+	//Anchoring a DBlock takes it out of the unanchored ones
+	dBlock, err := LoadDBlock("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchored := *dBlock
+	anchored.AnchorRecord = "anchor1"
+	err = SaveDBlock(&anchored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unanchored, total, err = GetUnanchoredDBlocks(time.Hour, now, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unanchored) != 0 || total != 0 {
+		t.Errorf("Anchored DBlock is still unanchored - %v of %v", unanchored, total)
+	}
+}
@@ -0,0 +1,660 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hoisie/web"
+)
+
+// APIError is the body returned by the JSON API whenever a request fails.
+type APIError struct {
+	Error string
+}
+
+func registerAPIRoutes() {
+	server.Get(`/api/v1/dblocks/?`, readLocked(handleAPIDBlocks))
+	server.Get(`/api/v1/dblock/height/([0-9]+)/?`, readLockedArg(handleAPIDBlockHeight))
+	server.Get(`/api/v1/dblock/([^/]+)?`, readLockedArg(handleAPIDBlock))
+	server.Get(`/api/v1/block/([^/]+)?`, readLockedArg(handleAPIBlock))
+	server.Get(`/api/v1/eblock/([^/]+)?`, readLockedArg(handleAPIBlock))
+	server.Get(`/api/v1/ablock/([^/]+)?`, readLockedArg(handleAPIBlock))
+	server.Get(`/api/v1/ecblock/([^/]+)?`, readLockedArg(handleAPIBlock))
+	server.Get(`/api/v1/fblock/([^/]+)?`, readLockedArg(handleAPIBlock))
+	server.Get(`/api/v1/entry/([^/]+)/proof/?`, readLockedArg(handleAPIEntryProof))
+	server.Get(`/api/v1/entry/([^/]+)?`, readLockedArg(handleAPIEntry))
+	server.Get(`/api/v1/tx/([^/]+)?`, readLockedArg(handleAPITransaction))
+	server.Get(`/api/v1/chains/?`, readLocked(handleAPIChains))
+	server.Get(`/api/v1/chain/([^/]+)/history/?`, readLockedArg(handleAPIChainHistory))
+	server.Get(`/api/v1/chain/([^/]+)?`, readLockedArg(handleAPIChain))
+	server.Get(`/api/v1/extid/(.+)`, readLockedArg(handleAPIExtID))
+	server.Get(`/api/v1/search/text/?`, readLocked(handleAPITextSearch))
+	server.Get(`/api/v1/search/?`, readLocked(handleAPISearch))
+	server.Get(`/api/v1/address/([^/]+)?`, readLockedArg(handleAPIAddress))
+	server.Get(`/api/v1/admin/?`, readLocked(handleAPIAdminHistory))
+	server.Get(`/api/v1/anchors/?`, readLocked(handleAPIAnchors))
+	server.Get(`/api/v1/status/?`, readLocked(handleAPIStatus))
+	server.Get(`/api/v1/reorgs/?`, readLocked(handleAPIReorgs))
+	server.Get(`/api/v1/quarantine/?`, readLocked(handleAPIQuarantine))
+	server.Get(`/api/v1/.*`, handleAPI404)
+}
+
+// IsValidHash reports whether s looks like a hex encoded 32 byte hash.
+func IsValidHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func writeJSON(ctx *web.Context, status int, data interface{}) {
+	ctx.ContentType("json")
+	ctx.WriteHeader(status)
+	err := json.NewEncoder(ctx).Encode(data)
+	if err != nil {
+		log.Printf("Error encoding JSON response - %v", err)
+	}
+}
+
+func writeJSONError(ctx *web.Context, status int, message string) {
+	writeJSON(ctx, status, APIError{Error: message})
+}
+
+func handleAPI404(ctx *web.Context) {
+	writeJSONError(ctx, http.StatusNotFound, "Not found")
+}
+
+func handleAPIDBlocks(ctx *web.Context) {
+	type dblocksResponse struct {
+		DBlocks  []*DBlock
+		PageInfo *PageState
+	}
+
+	height := GetBlockHeight()
+	dBlocks, err := GetDBlocksReverseOrder(0, height)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	d := dblocksResponse{
+		DBlocks: dBlocks,
+		PageInfo: &PageState{
+			Current: 1,
+			Max:     (len(dBlocks) / 50) + 1,
+		},
+	}
+
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid page")
+			return
+		}
+		d.PageInfo.Current = page
+	}
+	if page > d.PageInfo.Max {
+		writeJSONError(ctx, http.StatusNotFound, "Page not found")
+		return
+	}
+	if i, j := 50*(page-1), 50*page; len(dBlocks) > j {
+		d.DBlocks = d.DBlocks[i:j]
+	} else {
+		d.DBlocks = d.DBlocks[i:]
+	}
+
+	writeJSON(ctx, http.StatusOK, d)
+}
+
+func handleAPIDBlock(ctx *web.Context, keyMR string) {
+	keyMR = strings.ToLower(keyMR)
+	if IsValidHash(keyMR) == false {
+		writeJSONError(ctx, http.StatusBadRequest, "Invalid DBlock KeyMR")
+		return
+	}
+
+	dblock, err := GetDBlock(keyMR)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if dblock == nil {
+		writeJSONError(ctx, http.StatusNotFound, "DBlock not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, dblock)
+}
+
+func handleAPIDBlockHeight(ctx *web.Context, height string) {
+	h, err := strconv.Atoi(height)
+	if err != nil {
+		writeJSONError(ctx, http.StatusBadRequest, "Invalid DBlock height")
+		return
+	}
+
+	dblock, err := LoadDBlockBySequence(h)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if dblock == nil {
+		writeJSONError(ctx, http.StatusNotFound, "DBlock not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, dblock)
+}
+
+// handleAPIBlock accepts whatever the block pages do - any hash the block is
+// indexed by in BlockIndexes, not only full KeyMRs.
+func handleAPIBlock(ctx *web.Context, hash string) {
+	hash = strings.ToLower(hash)
+	if hash == "" {
+		writeJSONError(ctx, http.StatusBadRequest, "Invalid block hash")
+		return
+	}
+
+	block, err := LoadBlock(hash)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if block == nil {
+		writeJSONError(ctx, http.StatusNotFound, "Block not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, block)
+}
+
+func handleAPIEntry(ctx *web.Context, hash string) {
+	type entryResponse struct {
+		*Entry
+		Commit *Entry
+	}
+
+	hash = strings.ToLower(hash)
+	if IsValidHash(hash) == false {
+		writeJSONError(ctx, http.StatusBadRequest, "Invalid entry hash")
+		return
+	}
+
+	entry, err := LoadEntry(hash)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entry == nil {
+		writeJSONError(ctx, http.StatusNotFound, "Entry not found")
+		return
+	}
+
+	e := entryResponse{Entry: entry}
+	e.Commit, err = GetEntryCommit(hash)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, e)
+}
+
+func handleAPIEntryProof(ctx *web.Context, hash string) {
+	hash = strings.ToLower(hash)
+	if IsValidHash(hash) == false {
+		writeJSONError(ctx, http.StatusBadRequest, "Invalid entry hash")
+		return
+	}
+
+	proof, err := BuildEntryProof(hash)
+	if err == ErrRawDBlockNotStored {
+		writeJSONError(ctx, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if proof == nil {
+		writeJSONError(ctx, http.StatusNotFound, "Entry not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, proof)
+}
+
+func handleAPITransaction(ctx *web.Context, txID string) {
+	txID = strings.ToLower(txID)
+	if IsValidHash(txID) == false {
+		writeJSONError(ctx, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	tx, err := LoadTransaction(txID)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tx == nil {
+		writeJSONError(ctx, http.StatusNotFound, "Transaction not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, tx)
+}
+
+func handleAPIAdminHistory(ctx *web.Context) {
+	type adminResponse struct {
+		Events   []*AdminEvent
+		PageInfo *PageState
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid page")
+			return
+		}
+	}
+
+	events, total, err := GetAdminHistory(ctx.Params["type"], 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pages := (total / 50) + 1
+	if page > pages {
+		writeJSONError(ctx, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, adminResponse{
+		Events: events,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     pages,
+		},
+	})
+}
+
+func handleAPIAnchors(ctx *web.Context) {
+	type anchorsResponse struct {
+		Anchors  []*AnchorStatus
+		PageInfo *PageState
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid page")
+			return
+		}
+	}
+
+	anchors, pages, err := GetAnchorStatuses(page, ctx.Params["unanchored"] == "true")
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if page > pages {
+		writeJSONError(ctx, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, anchorsResponse{
+		Anchors: anchors,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     pages,
+		},
+	})
+}
+
+func handleAPIChains(ctx *web.Context) {
+	type chainsResponse struct {
+		Chains   []*Chain
+		PageInfo *PageState
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid page")
+			return
+		}
+	}
+
+	chains, total, err := GetChains(ctx.Params["sort"], 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c := chainsResponse{
+		Chains: chains,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     (total / 50) + 1,
+		},
+	}
+	if page > c.PageInfo.Max {
+		writeJSONError(ctx, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, c)
+}
+
+func handleAPIChain(ctx *web.Context, hash string) {
+	chain, ok := loadAPIChain(ctx, hash)
+	if ok == false {
+		return
+	}
+	if chain.FirstEntry == nil && chain.FirstEntryID != "" {
+		chainCopy := *chain
+		chain = &chainCopy
+		var err error
+		chain.FirstEntry, err = LoadEntry(chain.FirstEntryID)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	writeJSON(ctx, http.StatusOK, chain)
+}
+
+// loadAPIChain looks a chain up by name or ID, writing the error response
+// itself if the chain cannot be found.
+func loadAPIChain(ctx *web.Context, hash string) (*Chain, bool) {
+	id, err := LoadChainIDByName(hash)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if id == "" {
+		id = strings.ToLower(hash)
+		if IsValidHash(id) == false {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid chain ID")
+			return nil, false
+		}
+	}
+
+	chain, err := LoadChain(id)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if chain == nil {
+		writeJSONError(ctx, http.StatusNotFound, "Chain not found")
+		return nil, false
+	}
+	return chain, true
+}
+
+func handleAPIChainHistory(ctx *web.Context, hash string) {
+	type historyResponse struct {
+		Chain    *Chain
+		Blocks   []*Block
+		PageInfo *PageState
+	}
+
+	chain, ok := loadAPIChain(ctx, hash)
+	if ok == false {
+		return
+	}
+
+	h := historyResponse{
+		Chain: chain,
+		PageInfo: &PageState{
+			Current: 1,
+			Max:     (chain.EntryCount / 50) + 1,
+		},
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid page")
+			return
+		}
+		h.PageInfo.Current = page
+	}
+	if page > h.PageInfo.Max {
+		writeJSONError(ctx, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	h.Blocks, err = GetChainHistory(chain, 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, h)
+}
+
+func handleAPIExtID(ctx *web.Context, eid string) {
+	type entriesResponse struct {
+		ExtID    string
+		Entries  []*Entry
+		PageInfo *PageState
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid page")
+			return
+		}
+	}
+
+	entries, total, err := GetEntriesByExtID(eid, 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	e := entriesResponse{
+		ExtID:   eid,
+		Entries: entries,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     (total / 50) + 1,
+		},
+	}
+	if page > e.PageInfo.Max {
+		writeJSONError(ctx, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, e)
+}
+
+func handleAPISearch(ctx *web.Context) {
+	//Private keys never go in a URL, so they are not answered either
+	if IsPrivateKey(ctx.Params["q"]) {
+		writeJSONError(ctx, http.StatusBadRequest, "Private keys are not accepted in URLs")
+		return
+	}
+
+	results, err := Search(ctx.Params["q"])
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, results)
+}
+
+func handleAPITextSearch(ctx *web.Context) {
+	type searchResponse struct {
+		Entries  []*Entry
+		Total    int
+		PageInfo *PageState
+	}
+
+	q, err := textQueryFromParams(ctx.Params)
+	if err != nil {
+		writeJSONError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid page")
+			return
+		}
+	}
+
+	entries, total, err := SearchText(q, 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s := searchResponse{
+		Entries: entries,
+		Total:   total,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     (total / 50) + 1,
+		},
+	}
+	if page > s.PageInfo.Max {
+		writeJSONError(ctx, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, s)
+}
+
+func handleAPIAddress(ctx *web.Context, hash string) {
+	type addressResponse struct {
+		*Address
+		Transactions []*AddressTransaction
+		PageInfo     *PageState
+	}
+
+	if IsPrivateKey(hash) {
+		writeJSONError(ctx, http.StatusBadRequest, "Private keys are not accepted in URLs")
+		return
+	}
+
+	var err error
+	height := -1
+	if h := ctx.Params["height"]; h != "" {
+		height, err = strconv.Atoi(h)
+		if err != nil || height < 0 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid height")
+			return
+		}
+	}
+
+	address, err := GetAddressInformation(hash, height)
+	if err != nil {
+		log.Println(err)
+		if err == ErrInvalidAddress || err == ErrInvalidAddressChecksum {
+			writeJSONError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			writeJSONError(ctx, http.StatusBadRequest, "Invalid page")
+			return
+		}
+	}
+
+	history, total, err := GetAddressHistory(hash, 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	a := addressResponse{
+		Address:      address,
+		Transactions: history,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     (total / 50) + 1,
+		},
+	}
+	if page > a.PageInfo.Max {
+		writeJSONError(ctx, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, a)
+}
+
+func handleAPIStatus(ctx *web.Context) {
+	writeJSON(ctx, http.StatusOK, GetSyncStatus())
+}
+
+func handleAPIReorgs(ctx *web.Context) {
+	reorgs, err := LoadReorgEvents()
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, reorgs)
+}
+
+func handleAPIQuarantine(ctx *web.Context) {
+	blocks, err := LoadQuarantinedBlocks()
+	if err != nil {
+		log.Println(err)
+		writeJSONError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(ctx, http.StatusOK, blocks)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIsValidHash(t *testing.T) {
+	valid := []string{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"df3ade9eec4b08d5379cc64270c30ea7315d8a8a1a69efe2b98a60ecdd69e604",
+	}
+	invalid := []string{
+		"",
+		"df3ade9eec4b08d5379cc64270c30ea7315d8a8a1a69efe2b98a60ecdd69e60",
+		"df3ade9eec4b08d5379cc64270c30ea7315d8a8a1a69efe2b98a60ecdd69e6zz",
+		"FA3eNd17NgaXZA3rXQVvzSvWHrpXfHWPzLQjJy2PQVQSc4ZutjC1",
+	}
+	for _, v := range valid {
+		if IsValidHash(v) == false {
+			t.Errorf("%v should be a valid hash", v)
+		}
+	}
+	for _, v := range invalid {
+		if IsValidHash(v) == true {
+			t.Errorf("%v should not be a valid hash", v)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// BitcoinClient is the source of the Bitcoin data anchors are verified
+// against. FileBitcoinClient serves transactions and block headers from a
+// file, other implementations can talk to a Bitcoin node or a block explorer.
+type BitcoinClient interface {
+	GetTransaction(txID string) (*BitcoinTransaction, error)
+	GetBlockHeader(hash string) (*BitcoinBlockHeader, error)
+}
+
+// BitcoinTransaction is a Bitcoin transaction along with the block it was
+// confirmed in. Hashes are in the usual reversed byte order.
+type BitcoinTransaction struct {
+	TXID      string
+	BlockHash string
+
+	//Position of the transaction in its block and the hashes of the Merkle
+	//tree linking it to the Merkle root of the block, bottom up
+	BlockIndex   int
+	MerkleBranch []string
+
+	//Hex encoded scripts of the outputs, in order
+	OutputScripts []string
+}
+
+// VerifyMerkleBranch checks that the Merkle branch of the transaction leads
+// from its TXID to the given Merkle root.
+func (tx *BitcoinTransaction) VerifyMerkleBranch(merkleRoot string) error {
+	h, err := decodeBitcoinHash(tx.TXID)
+	if err != nil {
+		return fmt.Errorf("Invalid TXID %v", tx.TXID)
+	}
+	index := tx.BlockIndex
+	for _, v := range tx.MerkleBranch {
+		sibling, err := decodeBitcoinHash(v)
+		if err != nil {
+			return fmt.Errorf("Invalid Merkle branch hash %v", v)
+		}
+		if index&1 == 0 {
+			h = sha256Sum(sha256Sum(h, sibling))
+		} else {
+			h = sha256Sum(sha256Sum(sibling, h))
+		}
+		index = index >> 1
+	}
+	root, err := decodeBitcoinHash(merkleRoot)
+	if err != nil {
+		return fmt.Errorf("Invalid Merkle root %v", merkleRoot)
+	}
+	if bytes.Equal(h, root) == false {
+		return fmt.Errorf("Bitcoin transaction is not in the Merkle tree of its block")
+	}
+	return nil
+}
+
+// decodeBitcoinHash decodes a hash in the usual reversed byte order into the
+// order it is hashed in.
+func decodeBitcoinHash(s string) ([]byte, error) {
+	h, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(h) != 32 {
+		return nil, fmt.Errorf("Wrong hash length %v", len(h))
+	}
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return h, nil
+}
+
+// BitcoinBlockHeader is the part of a Bitcoin block header anchors are
+// verified against. Headers are trusted as served by the BitcoinClient -
+// their proof of work is not checked.
+type BitcoinBlockHeader struct {
+	Hash          string
+	Height        int32
+	PrevBlockHash string
+	MerkleRoot    string
+	Timestamp     uint32
+}
+
+// Bitcoin is the BitcoinClient used to verify anchors, nil if none is
+// configured.
+var Bitcoin BitcoinClient
+
+func init() {
+	headerFile := ReadConfig().Bitcoin.HeaderFile
+	if headerFile == "" {
+		return
+	}
+	fc, err := LoadFileBitcoinClient(headerFile)
+	if err != nil {
+		panic(err)
+	}
+	Bitcoin = fc
+}
+
+//-----------------------------------------------------------------------------------------------
+//--------------------------------------------File-----------------------------------------------
+//-----------------------------------------------------------------------------------------------
+
+// FileBitcoinClient serves a fixed set of Bitcoin transactions and block headers.
+type FileBitcoinClient struct {
+	mutex sync.RWMutex
+
+	Transactions map[string]*BitcoinTransaction
+	Headers      map[string]*BitcoinBlockHeader
+}
+
+var _ BitcoinClient = (*FileBitcoinClient)(nil)
+
+func NewFileBitcoinClient() *FileBitcoinClient {
+	fc := new(FileBitcoinClient)
+	fc.Transactions = map[string]*BitcoinTransaction{}
+	fc.Headers = map[string]*BitcoinBlockHeader{}
+	return fc
+}
+
+// LoadFileBitcoinClient reads a JSON file of Bitcoin transactions and block
+// headers keyed by their hashes.
+func LoadFileBitcoinClient(filename string) (*FileBitcoinClient, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	fc := NewFileBitcoinClient()
+	err = json.Unmarshal(data, fc)
+	if err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+func (c *FileBitcoinClient) AddTransaction(tx *BitcoinTransaction) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Transactions[tx.TXID] = tx
+}
+
+func (c *FileBitcoinClient) AddBlockHeader(header *BitcoinBlockHeader) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Headers[header.Hash] = header
+}
+
+func (c *FileBitcoinClient) GetTransaction(txID string) (*BitcoinTransaction, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	tx, found := c.Transactions[txID]
+	if found == false {
+		return nil, fmt.Errorf("Bitcoin transaction %v not found", txID)
+	}
+	return tx, nil
+}
+
+func (c *FileBitcoinClient) GetBlockHeader(hash string) (*BitcoinBlockHeader, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	header, found := c.Headers[hash]
+	if found == false {
+		return nil, fmt.Errorf("Bitcoin block %v not found", hash)
+	}
+	return header, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is a concurrency-safe LRU cache. A MaxSize of 0 or less means the
+// cache is never trimmed. Cached values are shared by every goroutine, so they
+// must never be changed in place - copy a value before changing it.
+type Cache struct {
+	mutex sync.Mutex
+
+	Name    string
+	MaxSize int
+
+	order *list.List
+	items map[string]*list.Element
+
+	hits   uint64
+	misses uint64
+}
+
+type cacheItem struct {
+	key   string
+	value interface{}
+}
+
+type CacheStats struct {
+	Name    string
+	Size    int
+	MaxSize int
+	Hits    uint64
+	Misses  uint64
+}
+
+func NewCache(name string, maxSize int) *Cache {
+	c := new(Cache)
+	c.Name = name
+	c.MaxSize = maxSize
+	c.order = list.New()
+	c.items = map[string]*list.Element{}
+	return c
+}
+
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, found := c.items[key]
+	if found == false {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheItem).value, true
+}
+
+func (c *Cache) Set(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, found := c.items[key]
+	if found == true {
+		el.Value.(*cacheItem).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheItem{key: key, value: value})
+
+	if c.MaxSize > 0 {
+		for c.order.Len() > c.MaxSize {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*cacheItem).key)
+		}
+	}
+}
+
+func (c *Cache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, found := c.items[key]
+	if found == false {
+		return
+	}
+	c.order.Remove(el)
+	delete(c.items, key)
+}
+
+// Clear removes every item from the cache.
+func (c *Cache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.order.Init()
+	c.items = map[string]*list.Element{}
+}
+
+// Values returns every cached value, most recently used first.
+func (c *Cache) Values() []interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	answer := make([]interface{}, 0, c.order.Len())
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		answer = append(answer, el.Value.(*cacheItem).value)
+	}
+	return answer
+}
+
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		Name:    c.Name,
+		Size:    c.order.Len(),
+		MaxSize: c.MaxSize,
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
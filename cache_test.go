@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache("test", 2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if _, found := c.Get("a"); found == false {
+		t.Errorf("a should be cached")
+	}
+	c.Set("c", 3)
+
+	if _, found := c.Get("b"); found == true {
+		t.Errorf("b should have been evicted")
+	}
+	if v, found := c.Get("a"); found == false || v.(int) != 1 {
+		t.Errorf("a should still be cached")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 cached values, got %v", c.Len())
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Wrong stats - %v", stats)
+	}
+
+	c.Delete("a")
+	if _, found := c.Get("a"); found == true {
+		t.Errorf("a should have been deleted")
+	}
+}
+
+func TestCacheUnbounded(t *testing.T) {
+	c := NewCache("test", 0)
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprintf("%v", i), i)
+	}
+	if c.Len() != 1000 {
+		t.Errorf("Expected 1000 cached values, got %v", c.Len())
+	}
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	c := NewCache("test", 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("%v", (i*j)%300)
+				c.Set(key, j)
+				c.Get(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if c.Len() > 100 {
+		t.Errorf("Cache grew past its limit - %v", c.Len())
+	}
+}
@@ -0,0 +1,510 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+// Inconsistency is a problem found in the database by CheckDatabase.
+type Inconsistency struct {
+	Bucket  string
+	Key     string
+	Problem string
+
+	//Repairs, nil if they would not help
+	refetch func() error
+	remove  func() error
+}
+
+func (i *Inconsistency) String() string {
+	return fmt.Sprintf("%v/%v - %v", i.Bucket, i.Key, i.Problem)
+}
+
+// databaseChecker gathers the inconsistencies found while scanning the database.
+type databaseChecker struct {
+	problems []*Inconsistency
+
+	//Bucket being scanned and the highest DBlock seen so far
+	bucket    string
+	maxHeight int
+
+	//Refetches by DBlock KeyMR, shared by every problem they repair
+	refetches map[string]func() error
+}
+
+func (c *databaseChecker) report(bucket, key, format string, args ...interface{}) *Inconsistency {
+	i := &Inconsistency{Bucket: bucket, Key: key, Problem: fmt.Sprintf(format, args...)}
+	c.problems = append(c.problems, i)
+	return i
+}
+
+// newRecords returns an empty record of the type stored in every bucket.
+var newRecords map[string]func() interface{} = map[string]func() interface{}{
+	DBlocksBucket:                func() interface{} { return new(DBlock) },
+	DBlockKeyMRsBySequenceBucket: func() interface{} { return new(string) },
+	BlocksBucket:                 func() interface{} { return new(Block) },
+	EntriesBucket:                func() interface{} { return new(Entry) },
+	ChainsBucket:                 func() interface{} { return new(Chain) },
+	ChainIDsByEncodedNameBucket:  func() interface{} { return new(string) },
+	ChainIDsByDecodedNameBucket:  func() interface{} { return new(string) },
+	BlockIndexesBucket:           func() interface{} { return new(string) },
+	DataStatusBucket:             func() interface{} { return new(DataStatusStruct) },
+	ReorgsBucket:                 func() interface{} { return new(ReorgEvent) },
+	ChainHeadsBucket:             func() interface{} { return new(string) },
+	ExtIDIndexesBucket:           func() interface{} { return new(string) },
+	TextIndexesBucket:            func() interface{} { return new(TextPosting) },
+	AnchorTransactionsBucket:     func() interface{} { return new(string) },
+	TransactionsBucket:           func() interface{} { return new(Transaction) },
+	AddressTransactionsBucket:    func() interface{} { return new(AddressTransaction) },
+	CommitsBucket:                func() interface{} { return new(string) },
+	QuarantineBucket:             func() interface{} { return new(QuarantinedBlock) },
+	ChainOrdersBucket:            func() interface{} { return new(string) },
+	AdminEventsBucket:            func() interface{} { return new(AdminEvent) },
+	UnanchoredDBlocksBucket:      func() interface{} { return new(string) },
+}
+
+// CheckDatabase scans every bucket in BucketList and returns everything that
+// does not add up - records that cannot be decoded, indexes pointing at
+// missing records, DBlocks and blocks with missing or broken links and gaps
+// in the DBlock sequence. Buckets are scanned with cursors and records are
+// cross-referenced with point lookups, so the database is never loaded whole.
+func CheckDatabase() ([]*Inconsistency, error) {
+	c := new(databaseChecker)
+	c.maxHeight = -1
+	c.refetches = map[string]func() error{}
+	checks := map[string]func(key string, record interface{}) error{
+		DBlocksBucket:               c.checkDBlock,
+		BlocksBucket:                c.checkBlock,
+		BlockIndexesBucket:          c.checkBlockIndex,
+		ChainsBucket:                c.checkChain,
+		ChainOrdersBucket:           c.checkReference(ChainsBucket, "Chain %v is missing"),
+		ChainHeadsBucket:            c.checkReference(BlocksBucket, "Head block %v is missing"),
+		ChainIDsByEncodedNameBucket: c.checkReference(ChainsBucket, "Chain %v is missing"),
+		ChainIDsByDecodedNameBucket: c.checkReference(ChainsBucket, "Chain %v is missing"),
+		ExtIDIndexesBucket:          c.checkReference(EntriesBucket, "Entry %v is missing"),
+		TextIndexesBucket:           c.checkTextPosting,
+		AnchorTransactionsBucket:    c.checkReference(DBlocksBucket, "Anchored DBlock %v is missing"),
+		TransactionsBucket:          c.checkTransaction,
+		CommitsBucket:               c.checkReference(EntriesBucket, "Commit %v is missing"),
+		AdminEventsBucket:           c.checkAdminEvent,
+		UnanchoredDBlocksBucket:     c.checkUnanchoredDBlock,
+	}
+
+	for _, bucket := range BucketList {
+		b, check := bucket, checks[bucket]
+		c.bucket = b
+		err := ScanBucket(b, func(key string, v []byte) error {
+			record, err := DecodeIndexValue(b, key, v, newRecords[b]())
+			if err != nil {
+				c.report(b, key, "Record cannot be decoded - %v", err).remove = deleteRecord(b, key)
+				return nil
+			}
+			if check == nil {
+				return nil
+			}
+			return check(key, record)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := c.checkSequence()
+	if err != nil {
+		return nil, err
+	}
+	return c.problems, nil
+}
+
+func deleteRecord(bucket, key string) func() error {
+	return func() error {
+		return DeleteData(bucket, key)
+	}
+}
+
+// checkReference returns a check of an index whose records are keys of
+// another bucket.
+func (c *databaseChecker) checkReference(target, problem string) func(key string, record interface{}) error {
+	return func(key string, record interface{}) error {
+		ref := *record.(*string)
+		found, err := HasData(target, ref)
+		if err != nil {
+			return err
+		}
+		if found == false {
+			c.report(c.bucket, key, problem, ref).remove = deleteRecord(c.bucket, key)
+		}
+		return nil
+	}
+}
+
+func (c *databaseChecker) checkDBlock(key string, record interface{}) error {
+	dBlock := record.(*DBlock)
+	if dBlock.SequenceNumber > c.maxHeight {
+		c.maxHeight = dBlock.SequenceNumber
+	}
+
+	seq, err := LoadDBlockKeyMRBySequence(dBlock.SequenceNumber)
+	if err != nil {
+		return err
+	}
+	if seq != key {
+		c.report(DBlockKeyMRsBySequenceBucket, fmt.Sprintf("%v", dBlock.SequenceNumber), "DBlock %v is not indexed by its height", key).refetch = func() error {
+			return SaveDBlockKeyMRBySequence(dBlock.KeyMR, dBlock.SequenceNumber)
+		}
+	}
+
+	if dBlock.BinaryString == "" {
+		c.report(DBlocksBucket, key, "Marshalled DBlock is not stored").refetch = c.refetchDBlock(key)
+	}
+
+	if dBlock.AnchorRecord == "" {
+		found, err := HasData(UnanchoredDBlocksBucket, unanchoredDBlockKey(dBlock.SequenceNumber, dBlock.KeyMR))
+		if err != nil {
+			return err
+		}
+		if found == false {
+			c.report(UnanchoredDBlocksBucket, key, "Unanchored DBlock %v is not indexed", key).refetch = func() error {
+				return indexDBlockAnchor(dBlock)
+			}
+		}
+	}
+
+	listed := append([]ListEntry{dBlock.AdminBlock, dBlock.EntryCreditBlock, dBlock.FactoidBlock}, dBlock.EntryBlockList...)
+	for _, l := range listed {
+		if l.KeyMR == "" {
+			continue
+		}
+		//DBlocks reference some blocks by their full hash
+		found, err := hasBlock(l.KeyMR)
+		if err != nil {
+			return err
+		}
+		if found == false {
+			c.report(DBlocksBucket, key, "Block %v of chain %v is missing", l.KeyMR, l.ChainID).refetch = c.refetchDBlock(key)
+		}
+	}
+
+	if IsHashZeroes(dBlock.PrevBlockKeyMR) == false {
+		prev, err := LoadDBlock(dBlock.PrevBlockKeyMR)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			c.report(DBlocksBucket, key, "Previous DBlock %v is missing", dBlock.PrevBlockKeyMR).refetch = c.refetchDBlock(dBlock.PrevBlockKeyMR)
+		} else if prev.SequenceNumber != dBlock.SequenceNumber-1 {
+			c.report(DBlocksBucket, key, "Previous DBlock %v is at height %v", dBlock.PrevBlockKeyMR, prev.SequenceNumber)
+		}
+	}
+	if dBlock.NextBlockKeyMR != "" {
+		found, err := HasData(DBlocksBucket, dBlock.NextBlockKeyMR)
+		if err != nil {
+			return err
+		}
+		if found == false {
+			c.report(DBlocksBucket, key, "Next DBlock %v is missing", dBlock.NextBlockKeyMR).remove = func() error {
+				dBlock.NextBlockKeyMR = ""
+				return SaveDBlock(dBlock)
+			}
+		}
+	}
+	return nil
+}
+
+// checkSequence looks for gaps in the DBlock sequence, up to the highest
+// DBlock found by checkDBlock.
+func (c *databaseChecker) checkSequence() error {
+	for i := 0; i <= c.maxHeight; i++ {
+		seq := strconv.Itoa(i)
+		keyMR, err := LoadDBlockKeyMRBySequence(i)
+		if err != nil {
+			return err
+		}
+		if keyMR == "" {
+			c.report(DBlockKeyMRsBySequenceBucket, seq, "No DBlock at height %v", i)
+			continue
+		}
+		found, err := HasData(DBlocksBucket, keyMR)
+		if err != nil {
+			return err
+		}
+		if found == false {
+			c.report(DBlockKeyMRsBySequenceBucket, seq, "DBlock %v is missing", keyMR).refetch = c.refetchDBlock(keyMR)
+		}
+	}
+	return nil
+}
+
+// hasBlock reports whether the block indexed by the hash is stored.
+func hasBlock(hash string) (bool, error) {
+	index, err := LoadBlockIndex(hash)
+	if err != nil {
+		return false, err
+	}
+	if index == "" {
+		return false, nil
+	}
+	return HasData(BlocksBucket, index)
+}
+
+// refetchDBlock synchronizes the DBlock again, the way Synchronize does, so
+// its blocks are stored along with everything derived from them. What was
+// linked to a stored DBlock after it was synchronized is kept.
+func refetchDBlock(keyMR string) func() error {
+	return func() error {
+		stored, err := LoadDBlock(keyMR)
+		if err != nil {
+			return err
+		}
+		dBlock, err := GetDBlockFromFactom(keyMR)
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			dBlock.NextBlockKeyMR = stored.NextBlockKeyMR
+			dBlock.AnchoredInTransaction = stored.AnchoredInTransaction
+			dBlock.AnchorRecord = stored.AnchorRecord
+			dBlock.AnchorTimestamp = stored.AnchorTimestamp
+			dBlock.AnchorVerified = stored.AnchorVerified
+			dBlock.AnchorVerificationErrors = stored.AnchorVerificationErrors
+		}
+		return synchronizeDBlock(dBlock, nil)
+	}
+}
+
+// refetchDBlock returns the refetch of the DBlock. Every problem it repairs
+// shares it, so the DBlock is only synchronized again once.
+func (c *databaseChecker) refetchDBlock(keyMR string) func() error {
+	refetch, found := c.refetches[keyMR]
+	if found == true {
+		return refetch
+	}
+	done := false
+	var result error
+	refetch = func() error {
+		if done == false {
+			done = true
+			result = refetchDBlock(keyMR)()
+		}
+		return result
+	}
+	c.refetches[keyMR] = refetch
+	return refetch
+}
+
+// refetchBlockDBlock returns the refetch of the DBlock the block belongs to.
+func (c *databaseChecker) refetchBlockDBlock(block *Block) (func() error, error) {
+	keyMR, err := LoadDBlockKeyMRBySequence(block.DBlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	if keyMR == "" {
+		return func() error {
+			return fmt.Errorf("No DBlock at height %v", block.DBlockHeight)
+		}, nil
+	}
+	return c.refetchDBlock(keyMR), nil
+}
+
+func (c *databaseChecker) checkBlock(key string, record interface{}) error {
+	block := record.(*Block)
+	for _, hash := range []string{block.PartialHash, block.FullHash} {
+		index, err := LoadBlockIndex(hash)
+		if err != nil {
+			return err
+		}
+		if index != key {
+			h := hash
+			c.report(BlockIndexesBucket, hash, "Block %v is not indexed", key).refetch = func() error {
+				return SaveBlockIndex(h, block.PartialHash)
+			}
+		}
+	}
+
+	if IsHashZeroes(block.PrevBlockHash) == false && block.PrevBlockHash != "" {
+		index, err := LoadBlockIndex(block.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		if index == "" {
+			c.report(BlocksBucket, key, "Previous block %v is missing", block.PrevBlockHash)
+		}
+	}
+	if block.NextBlockHash != "" {
+		index, err := LoadBlockIndex(block.NextBlockHash)
+		if err != nil {
+			return err
+		}
+		if index == "" {
+			c.report(BlocksBucket, key, "Next block %v is missing", block.NextBlockHash).remove = func() error {
+				block.NextBlockHash = ""
+				return SaveBlock(block)
+			}
+		}
+	}
+
+	if block.IsEntryBlock == false {
+		return nil
+	}
+	for _, e := range block.EntryList {
+		found, err := HasData(EntriesBucket, e.Hash)
+		if err != nil {
+			return err
+		}
+		if found == false {
+			refetch, err := c.refetchBlockDBlock(block)
+			if err != nil {
+				return err
+			}
+			c.report(BlocksBucket, key, "Entry %v is missing", e.Hash).refetch = refetch
+		}
+	}
+	return nil
+}
+
+func (c *databaseChecker) checkBlockIndex(key string, record interface{}) error {
+	hash := *record.(*string)
+	found, err := HasData(BlocksBucket, hash)
+	if err != nil {
+		return err
+	}
+	if found == false {
+		c.report(BlockIndexesBucket, key, "Indexed block %v is missing", hash).remove = deleteRecord(BlockIndexesBucket, key)
+	}
+	return nil
+}
+
+func (c *databaseChecker) checkChain(key string, record interface{}) error {
+	chain := record.(*Chain)
+	if chain.FirstEntryID == "" {
+		c.report(ChainsBucket, key, "Chain has no first entry")
+	} else {
+		found, err := HasData(EntriesBucket, chain.FirstEntryID)
+		if err != nil {
+			return err
+		}
+		if found == false {
+			c.report(ChainsBucket, key, "First entry %v is missing", chain.FirstEntryID)
+		}
+	}
+	for _, order := range chainOrderKeys(chain) {
+		found, err := HasData(ChainOrdersBucket, order)
+		if err != nil {
+			return err
+		}
+		if found == false {
+			c.report(ChainOrdersBucket, order, "Chain %v is not listed", key).refetch = func() error {
+				return saveChainOrders(nil, chain)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *databaseChecker) checkTextPosting(key string, record interface{}) error {
+	hash := record.(*TextPosting).Hash
+	found, err := HasData(EntriesBucket, hash)
+	if err != nil {
+		return err
+	}
+	if found == false {
+		c.report(TextIndexesBucket, key, "Entry %v is missing", hash).remove = deleteRecord(TextIndexesBucket, key)
+	}
+	return nil
+}
+
+func (c *databaseChecker) checkTransaction(key string, record interface{}) error {
+	fBlock := record.(*Transaction).FBlock
+	found, err := HasData(BlockIndexesBucket, fBlock)
+	if err != nil {
+		return err
+	}
+	if found == false {
+		c.report(TransactionsBucket, key, "Factoid block %v is missing", fBlock).remove = deleteRecord(TransactionsBucket, key)
+	}
+	return nil
+}
+
+func (c *databaseChecker) checkAdminEvent(key string, record interface{}) error {
+	aBlock := record.(*AdminEvent).ABlock
+	found, err := HasData(BlocksBucket, aBlock)
+	if err != nil {
+		return err
+	}
+	if found == false {
+		c.report(AdminEventsBucket, key, "Admin block %v is missing", aBlock).remove = deleteRecord(AdminEventsBucket, key)
+	}
+	return nil
+}
+
+func (c *databaseChecker) checkUnanchoredDBlock(key string, record interface{}) error {
+	keyMR := *record.(*string)
+	dBlock, err := LoadDBlock(keyMR)
+	if err != nil {
+		return err
+	}
+	if dBlock == nil {
+		c.report(UnanchoredDBlocksBucket, key, "DBlock %v is missing", keyMR).remove = deleteRecord(UnanchoredDBlocksBucket, key)
+	} else if dBlock.AnchorRecord != "" {
+		c.report(UnanchoredDBlocksBucket, key, "DBlock %v is anchored", keyMR).remove = deleteRecord(UnanchoredDBlocksBucket, key)
+	}
+	return nil
+}
+
+// RunCheck is the offline check mode of the binary. It reports every
+// inconsistency in the database and, if asked to, repairs what it can by
+// refetching records from the node or deleting the broken ones. It returns
+// the exit code of the process.
+func RunCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	refetch := flags.Bool("refetch", false, "rebuild missing records and indexes, fetching them from the node where needed")
+	remove := flags.Bool("delete", false, "delete broken records and dangling indexes")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if cfg.UseDatabase == false {
+		fmt.Println("The database is disabled in the configuration, nothing to check")
+		return 1
+	}
+
+	problems, err := CheckDatabase()
+	if err != nil {
+		fmt.Printf("Error checking the database - %v\n", err)
+		return 1
+	}
+
+	unrepaired := 0
+	for _, v := range problems {
+		var repair func() error
+		var action string
+		if *refetch == true && v.refetch != nil {
+			repair, action = v.refetch, "refetched"
+		} else if *remove == true && v.remove != nil {
+			repair, action = v.remove, "deleted"
+		}
+		if repair == nil {
+			fmt.Println(v)
+			unrepaired++
+			continue
+		}
+		err = repair()
+		if err != nil {
+			fmt.Printf("%v - repair failed - %v\n", v, err)
+			unrepaired++
+			continue
+		}
+		fmt.Printf("%v - %v\n", v, action)
+	}
+
+	fmt.Printf("%v inconsistencies found, %v left unrepaired\n", len(problems), unrepaired)
+	if unrepaired > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckDatabase(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	defer initTestDatabase(t)()
+
+	block := new(Block)
+	block.ChainID = "000000000000000000000000000000000000000000000000000000000000000a"
+	block.PartialHash = "b0"
+	block.FullHash = "fb0"
+	block.PrevBlockHash = zeroHash
+	err := SaveBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveBlockIndex("dangling", "b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dBlock := new(DBlock)
+	dBlock.KeyMR = "d0"
+	dBlock.PrevBlockKeyMR = zeroHash
+	dBlock.AdminBlock = ListEntry{ChainID: block.ChainID, KeyMR: "fb0"}
+	dBlock.EntryBlockList = []ListEntry{ListEntry{ChainID: "cc", KeyMR: "e0"}}
+	err = SaveDBlock(dBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveTestDBlock(t, "d2", "d1", 2)
+
+	problems, err := CheckDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"DBlocks/d0 - Marshalled DBlock is not stored",
+		"DBlocks/d0 - Block e0 of chain cc is missing",
+		"DBlocks/d2 - Marshalled DBlock is not stored",
+		"DBlocks/d2 - Previous DBlock d1 is missing",
+		"DBlockKeyMRsBySequence/1 - No DBlock at height 1",
+		"BlockIndexes/dangling - Indexed block b1 is missing",
+	}
+	found := map[string]bool{}
+	for _, v := range problems {
+		found[v.String()] = true
+	}
+	for _, v := range expected {
+		if found[v] == false {
+			t.Errorf("Missing inconsistency %v in %v", v, problems)
+		}
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("Wrong number of inconsistencies - %v", problems)
+	}
+
+	for _, v := range problems {
+		if v.remove != nil {
+			err = v.remove()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	problems, err = CheckDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 5 {
+		t.Errorf("Dangling index was not deleted - %v", problems)
+	}
+}
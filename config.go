@@ -15,10 +15,33 @@ type ExplorerConfig struct {
 		StaticDir   string
 		DatabaseDir string
 		UseDatabase bool
+		//How many requests to make to factomd at the same time while synchronizing
+		FetchWorkers int
 	}
 	Anchor struct {
 		AnchorChainID string
+		//Hex encoded ed25519 key anchor records are signed with
+		AnchorPublicKey string
+		//Minutes after which a DBlock that is still not anchored gets reported
+		UnanchoredAge int
 	}
+	Node struct {
+		FixtureFile string
+	}
+	Bitcoin struct {
+		HeaderFile string
+	}
+	Cache CacheConfig
+}
+
+// CacheConfig holds the maximum number of objects kept in memory per type, 0
+// for the default and -1 for no limit.
+type CacheConfig struct {
+	DBlocks int
+	Blocks  int
+	Entries int
+	Chains  int
+	Indexes int
 }
 
 const defaultConfig = `
@@ -31,9 +54,28 @@ PortNumber	= 8087
 StaticDir	= ""
 DatabaseDir	= "/tmp/"
 UseDatabase	= true
+FetchWorkers	= 8
 
 [anchor]
 AnchorChainID						= df3ade9eec4b08d5379cc64270c30ea7315d8a8a1a69efe2b98a60ecdd69e604
+AnchorPublicKey						= 0426a802617848d4d16d87830fc521f4d136bb2d0c352850919c2679f189613a
+UnanchoredAge						= 60
+
+[cache]
+; Objects kept in memory per type, -1 for no limit
+DBlocks		= 1000
+Blocks		= 1000
+Entries		= 10000
+Chains		= 1000
+Indexes		= 100000
+
+[node]
+; Serve blocks from a fixture file instead of a live factomd when set
+FixtureFile	= ""
+
+[bitcoin]
+; Verify anchors against Bitcoin transactions and block headers from a file when set
+HeaderFile	= ""
 `
 
 // ReadConfig reads the default factomexplorer.conf file and returns the
@@ -44,6 +86,26 @@ func ReadConfig() *ExplorerConfig {
 	err := gcfg.ReadFileInto(cfg, filename)
 	if err != nil {
 		gcfg.ReadStringInto(cfg, defaultConfig)
+		return cfg
 	}
+	applyConfigDefaults(cfg)
 	return cfg
 }
+
+// applyConfigDefaults fills the settings a config file leaves out, which read
+// as 0, with the values of the default config.
+func applyConfigDefaults(cfg *ExplorerConfig) {
+	defaults := new(ExplorerConfig)
+	gcfg.ReadStringInto(defaults, defaultConfig)
+
+	if cfg.Explorer.FetchWorkers == 0 {
+		cfg.Explorer.FetchWorkers = defaults.Explorer.FetchWorkers
+	}
+	sizes := []*int{&cfg.Cache.DBlocks, &cfg.Cache.Blocks, &cfg.Cache.Entries, &cfg.Cache.Chains, &cfg.Cache.Indexes}
+	defaultSizes := []int{defaults.Cache.DBlocks, defaults.Cache.Blocks, defaults.Cache.Entries, defaults.Cache.Chains, defaults.Cache.Indexes}
+	for i, v := range sizes {
+		if *v == 0 {
+			*v = defaultSizes[i]
+		}
+	}
+}
@@ -8,17 +8,23 @@ import (
 	"github.com/FactomProject/factom"
 	"log"
 	"strings"
+	"sync"
+	"time"
 )
 
-var DBlocks map[string]*DBlock
-var DBlockKeyMRsBySequence map[string]string
-var Blocks map[string]*Block
-var Entries map[string]*Entry
-var Chains map[string]*Chain
-var ChainIDsByEncodedName map[string]string
-var ChainIDsByDecodedName map[string]string
+var DBlocks *Cache                //*DBlock
+var DBlockKeyMRsBySequence *Cache //string
+var Blocks *Cache                 //*Block
+var Entries *Cache                //*Entry
+var Chains *Cache                 //*Chain
+var Transactions *Cache           //*Transaction
+var Commits *Cache                //string, hash of the entry credit block entry that paid for an entry
+var ChainIDsByEncodedName *Cache  //string
+var ChainIDsByDecodedName *Cache  //string
 
-var BlockIndexes map[string]string //used to index blocks by both their full and partial hash
+var BlockIndexes *Cache       //string, used to index blocks by both their full and partial hash
+var ChainHeads *Cache         //string, KeyMR of the newest block of every chain
+var AnchorTransactions *Cache //string, KeyMR of the DBlock anchored in a Bitcoin transaction
 
 type DataStatusStruct struct {
 	DBlockHeight int
@@ -27,9 +33,33 @@ type DataStatusStruct struct {
 	LastKnownBlock string
 	//Last DBlock we have processed and connected back and forth
 	LastProcessedBlock string
+
+	//Last time a synchronization pass finished without errors
+	LastSyncTime time.Time
+	//Last synchronization error, empty if the latest pass succeeded
+	LastError     string
+	LastErrorTime time.Time
+	//Number of synchronization passes that failed in a row
+	FailedAttempts int
+
+	//Number of chain reorganizations we have rolled back
+	Reorgs int
+	//Number of blocks quarantined because they failed verification
+	Quarantined int
+	//DBlock that failed verification, nothing past it is synchronized until
+	//the node's chain no longer leads through it
+	HaltedAt string
+}
+
+// IsNodeReachable reports whether the latest synchronization pass succeeded.
+func (ds DataStatusStruct) IsNodeReachable() bool {
+	return ds.FailedAttempts == 0
 }
 
+// DataStatus is the last saved DataStatusStruct. It is only accessed under
+// dataStatusMutex, and only ever handed out as a copy.
 var DataStatus *DataStatusStruct
+var dataStatusMutex sync.Mutex
 
 const DBlocksBucket string = "DBlocks"
 const DBlockKeyMRsBySequenceBucket string = "DBlockKeyMRsBySequence"
@@ -40,22 +70,75 @@ const ChainIDsByEncodedNameBucket string = "ChainIDsByEncodedName"
 const ChainIDsByDecodedNameBucket string = "ChainIDsByDecodedName"
 const BlockIndexesBucket string = "BlockIndexes"
 const DataStatusBucket string = "DataStatus"
-
-var BucketList []string = []string{DBlocksBucket, DBlockKeyMRsBySequenceBucket, BlocksBucket, EntriesBucket, ChainsBucket, ChainIDsByEncodedNameBucket, ChainIDsByDecodedNameBucket, BlockIndexesBucket, DataStatusBucket}
+const ReorgsBucket string = "Reorgs"
+const ChainHeadsBucket string = "ChainHeads"
+const ExtIDIndexesBucket string = "ExtIDIndexes"
+const TextIndexesBucket string = "TextIndexes"
+const AnchorTransactionsBucket string = "AnchorTransactions"
+const TransactionsBucket string = "Transactions"
+const AddressTransactionsBucket string = "AddressTransactions"
+const CommitsBucket string = "Commits"
+const QuarantineBucket string = "Quarantine"
+const ChainOrdersBucket string = "ChainOrders"
+const AdminEventsBucket string = "AdminEvents"
+const UnanchoredDBlocksBucket string = "UnanchoredDBlocks"
+
+var BucketList []string = []string{DBlocksBucket, DBlockKeyMRsBySequenceBucket, BlocksBucket, EntriesBucket, ChainsBucket, ChainIDsByEncodedNameBucket, ChainIDsByDecodedNameBucket, BlockIndexesBucket, DataStatusBucket, ReorgsBucket, ChainHeadsBucket, ExtIDIndexesBucket, TextIndexesBucket, AnchorTransactionsBucket, TransactionsBucket, AddressTransactionsBucket, CommitsBucket, QuarantineBucket, ChainOrdersBucket, AdminEventsBucket, UnanchoredDBlocksBucket}
 
 func init() {
-	DBlocks = map[string]*DBlock{}
-	DBlockKeyMRsBySequence = map[string]string{}
-	Blocks = map[string]*Block{}
-	Entries = map[string]*Entry{}
-	BlockIndexes = map[string]string{}
-	Chains = map[string]*Chain{}
-	ChainIDsByEncodedName = map[string]string{}
-	ChainIDsByDecodedName = map[string]string{}
+	InitCaches(ReadConfig().Cache)
 
 	//DataStatus.LastKnownBlock = "0000000000000000000000000000000000000000000000000000000000000000"
 }
 
+// InitCaches sets up the in-memory caches in front of the database. Without
+// a database the caches are the only storage, so they are never trimmed.
+func InitCaches(sizes CacheConfig) {
+	if cfg.UseDatabase == false {
+		sizes = CacheConfig{}
+	}
+	DBlocks = NewCache("DBlocks", sizes.DBlocks)
+	DBlockKeyMRsBySequence = NewCache("DBlockKeyMRsBySequence", sizes.Indexes)
+	Blocks = NewCache("Blocks", sizes.Blocks)
+	Entries = NewCache("Entries", sizes.Entries)
+	BlockIndexes = NewCache("BlockIndexes", sizes.Indexes)
+	Chains = NewCache("Chains", sizes.Chains)
+	Transactions = NewCache("Transactions", sizes.Entries)
+	Commits = NewCache("Commits", sizes.Indexes)
+	ChainIDsByEncodedName = NewCache("ChainIDsByEncodedName", sizes.Indexes)
+	ChainIDsByDecodedName = NewCache("ChainIDsByDecodedName", sizes.Indexes)
+	ChainHeads = NewCache("ChainHeads", sizes.Indexes)
+	AnchorTransactions = NewCache("AnchorTransactions", sizes.Indexes)
+	ClearMemoryIndexes()
+}
+
+func allCaches() []*Cache {
+	return []*Cache{DBlocks, DBlockKeyMRsBySequence, Blocks, Entries, BlockIndexes, Chains, ChainIDsByEncodedName, ChainIDsByDecodedName, ChainHeads, AnchorTransactions, Transactions, Commits}
+}
+
+// ClearCaches empties the caches, so everything is read back from the
+// database. Without a database the caches are the only storage and are kept.
+func ClearCaches() {
+	if cfg.UseDatabase == false {
+		return
+	}
+	for _, v := range allCaches() {
+		v.Clear()
+	}
+	dataStatusMutex.Lock()
+	DataStatus = nil
+	dataStatusMutex.Unlock()
+}
+
+func GetCacheStats() []CacheStats {
+	caches := allCaches()
+	answer := make([]CacheStats, len(caches))
+	for i, v := range caches {
+		answer[i] = v.Stats()
+	}
+	return answer
+}
+
 type ListEntry struct {
 	ChainID string
 	KeyMR   string
@@ -77,8 +160,16 @@ type DBlock struct {
 	BlockTimeStr string
 	KeyMR        string
 
+	//Hex encoded marshalled DBlock, kept for Merkle proofs
+	BinaryString string
+
 	AnchoredInTransaction string
 	AnchorRecord          string
+	AnchorTimestamp       uint64 //time of the DBlock the anchor entry was included in
+
+	//Whether the anchor was checked against its signature and Bitcoin, and why not
+	AnchorVerified           bool
+	AnchorVerificationErrors []string
 
 	Blocks int
 
@@ -122,10 +213,17 @@ type Block struct {
 	PrevBlockHash string
 	NextBlockHash string
 
+	//Height of the DBlock the block was included in
+	DBlockHeight int
+
 	EntryCount int
 
 	EntryList []*Entry
 
+	//Entry credit blocks only - credits spent on commits and bought
+	ECSpent     int
+	ECPurchased int
+
 	IsAdminBlock       bool
 	IsFactoidBlock     bool
 	IsEntryCreditBlock bool
@@ -157,8 +255,17 @@ type Entry struct {
 	//Marshallable blocks
 	Hash string
 
+	//Entry blocks only - KeyMR of the block the entry was included in
+	EntryBlock string
+
 	//Anchor chain-specific data
 	AnchorRecord *AnchorRecord
+
+	//Entry credit block-specific data
+	ECEntry *ECEntry
+
+	//Admin block-specific data
+	AdminEntry *AdminEntry
 }
 
 type AnchorRecord struct {
@@ -188,11 +295,35 @@ type Chain struct {
 	ChainID      string
 	Names        []DecodedString
 	FirstEntryID string
+	HeadKeyMR    string
+
+	//Heights of the DBlocks the chain was created and last written in
+	FirstDBlockHeight int
+	LastDBlockHeight  int
+	EntryBlockCount   int
+	EntryCount        int
+	//Size of all the chain's entries, in bytes
+	TotalBytes int
 
 	//Not saved
 	FirstEntry *Entry
 }
 
+// ReorgEvent records a rollback of DBlocks that were no longer part of the node's chain
+type ReorgEvent struct {
+	Time time.Time
+
+	//Height and KeyMR of the last DBlock shared by both chains, -1 if none
+	ForkHeight int
+	ForkKeyMR  string
+
+	OldHead   string
+	OldHeight int
+	NewHead   string
+
+	OrphanedDBlocks []string
+}
+
 type DecodedString struct {
 	Encoded string
 	Decoded string
@@ -214,12 +345,22 @@ func RecordChain(block *Block) error {
 		return nil
 	}
 
-	c := new(Chain)
-	c.ChainID = block.ChainID
+	c, err := LoadChain(block.ChainID)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		c = new(Chain)
+		c.ChainID = block.ChainID
+	} else {
+		chainCopy := *c
+		c = &chainCopy
+	}
 	c.FirstEntryID = block.EntryList[0].Hash
 	c.Names = block.EntryList[0].ExternalIDs[:]
+	c.FirstDBlockHeight = block.DBlockHeight
 
-	err := SaveChain(c)
+	err = SaveChain(c)
 	if err != nil {
 		return err
 	}
@@ -228,6 +369,42 @@ func RecordChain(block *Block) error {
 	return nil
 }
 
+// UpdateChainStats adds a newly synchronized entry block to its chain's statistics.
+func UpdateChainStats(block *Block) error {
+	c, err := LoadChain(block.ChainID)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		c = new(Chain)
+		c.ChainID = block.ChainID
+		c.FirstDBlockHeight = block.DBlockHeight
+	} else {
+		chainCopy := *c
+		c = &chainCopy
+	}
+	//Blocks refetched by the database check can be older than the head
+	if c.LastDBlockHeight <= block.DBlockHeight {
+		c.HeadKeyMR = block.PartialHash
+	}
+	c.EntryBlockCount++
+	c.EntryCount += block.EntryCount
+	c.TotalBytes += BlockEntriesSize(block)
+	if c.LastDBlockHeight < block.DBlockHeight {
+		c.LastDBlockHeight = block.DBlockHeight
+	}
+	return SaveChain(c)
+}
+
+// BlockEntriesSize returns the size of the raw entries of a block, in bytes.
+func BlockEntriesSize(block *Block) int {
+	size := 0
+	for _, v := range block.EntryList {
+		size += len(v.BinaryString) / 2
+	}
+	return size
+}
+
 func StoreEntriesFromBlock(block *Block) error {
 	for _, v := range block.EntryList {
 		err := SaveEntry(v)
@@ -240,9 +417,9 @@ func StoreEntriesFromBlock(block *Block) error {
 
 func LoadDBlockKeyMRBySequence(sequence int) (string, error) {
 	seq := fmt.Sprintf("%v", sequence)
-	keyMR, found := DBlockKeyMRsBySequence[seq]
+	keyMR, found := DBlockKeyMRsBySequence.Get(seq)
 	if found == true {
-		return keyMR, nil
+		return keyMR.(string), nil
 	}
 
 	key := new(string)
@@ -253,7 +430,7 @@ func LoadDBlockKeyMRBySequence(sequence int) (string, error) {
 	if key2 == nil {
 		return "", nil
 	}
-	DBlockKeyMRsBySequence[seq] = *key
+	DBlockKeyMRsBySequence.Set(seq, *key)
 	return *key, nil
 }
 
@@ -263,7 +440,17 @@ func SaveDBlockKeyMRBySequence(keyMR string, sequence int) error {
 	if err != nil {
 		return err
 	}
-	DBlockKeyMRsBySequence[seq] = keyMR
+	DBlockKeyMRsBySequence.Set(seq, keyMR)
+	return nil
+}
+
+func DeleteDBlockKeyMRBySequence(sequence int) error {
+	seq := fmt.Sprintf("%v", sequence)
+	err := DeleteData(DBlockKeyMRsBySequenceBucket, seq)
+	if err != nil {
+		return err
+	}
+	DBlockKeyMRsBySequence.Delete(seq)
 	return nil
 }
 
@@ -273,23 +460,28 @@ func SaveDBlock(b *DBlock) error {
 	if err != nil {
 		return err
 	}
-	DBlocks[b.KeyMR] = b
+	DBlocks.Set(b.KeyMR, b)
 
 	err = SaveDBlockKeyMRBySequence(b.KeyMR, b.SequenceNumber)
 	if err != nil {
 		return err
 	}
 
+	err = indexDBlockAnchor(b)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func LoadDBlock(hash string) (*DBlock, error) {
-	block, ok := DBlocks[hash]
+	cached, ok := DBlocks.Get(hash)
 	if ok == true {
-		return block, nil
+		return cached.(*DBlock), nil
 	}
 
-	block = new(DBlock)
+	block := new(DBlock)
 	block2, err := LoadData(DBlocksBucket, hash, block)
 	if err != nil {
 		return nil, err
@@ -297,10 +489,36 @@ func LoadDBlock(hash string) (*DBlock, error) {
 	if block2 == nil {
 		return nil, nil
 	}
-	DBlocks[hash] = block
+	DBlocks.Set(hash, block)
 	return block, nil
 }
 
+func DeleteDBlock(b *DBlock) error {
+	err := DeleteData(DBlocksBucket, b.KeyMR)
+	if err != nil {
+		return err
+	}
+	DBlocks.Delete(b.KeyMR)
+
+	err = DeleteIndexKey(UnanchoredDBlocksBucket, unanchoredDBlockKey(b.SequenceNumber, b.KeyMR))
+	if err != nil {
+		return err
+	}
+
+	key, err := LoadDBlockKeyMRBySequence(b.SequenceNumber)
+	if err != nil {
+		return err
+	}
+	if key == b.KeyMR {
+		err = DeleteDBlockKeyMRBySequence(b.SequenceNumber)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func LoadDBlockBySequence(sequence int) (*DBlock, error) {
 	key, err := LoadDBlockKeyMRBySequence(sequence)
 	if err != nil {
@@ -317,14 +535,14 @@ func SaveBlockIndex(index, hash string) error {
 	if err != nil {
 		return err
 	}
-	BlockIndexes[index] = hash
+	BlockIndexes.Set(index, hash)
 	return nil
 }
 
 func LoadBlockIndex(hash string) (string, error) {
-	index, found := BlockIndexes[hash]
+	index, found := BlockIndexes.Get(hash)
 	if found == true {
-		return index, nil
+		return index.(string), nil
 	}
 
 	ind := new(string)
@@ -335,10 +553,19 @@ func LoadBlockIndex(hash string) (string, error) {
 	if ind2 == nil {
 		return "", nil
 	}
-	BlockIndexes[hash] = *ind
+	BlockIndexes.Set(hash, *ind)
 	return *ind, nil
 }
 
+func DeleteBlockIndex(index string) error {
+	err := DeleteData(BlockIndexesBucket, index)
+	if err != nil {
+		return err
+	}
+	BlockIndexes.Delete(index)
+	return nil
+}
+
 func SaveBlock(b *Block) error {
 	StoreEntriesFromBlock(b)
 
@@ -355,7 +582,7 @@ func SaveBlock(b *Block) error {
 	if err != nil {
 		return err
 	}
-	Blocks[b.PartialHash] = b
+	Blocks.Set(b.PartialHash, b)
 
 	if b.IsEntryBlock {
 		RecordChain(b)
@@ -373,12 +600,12 @@ func LoadBlock(hash string) (*Block, error) {
 		return nil, nil
 	}
 
-	block, ok := Blocks[key]
+	cached, ok := Blocks.Get(key)
 	if ok == true {
-		return block, nil
+		return cached.(*Block), nil
 	}
 
-	block = new(Block)
+	block := new(Block)
 	block2, err := LoadData(BlocksBucket, key, block)
 	if err != nil {
 		return nil, err
@@ -386,27 +613,65 @@ func LoadBlock(hash string) (*Block, error) {
 	if block2 == nil {
 		return nil, nil
 	}
-	Blocks[key] = block
-	Blocks[hash] = block
+	Blocks.Set(key, block)
+	Blocks.Set(hash, block)
 	return block, nil
 }
 
+// DeleteBlock removes the block, its indexes and its entries.
+func DeleteBlock(b *Block) error {
+	if b.IsEntryBlock {
+		err := UnindexBlockText(b)
+		if err != nil {
+			return err
+		}
+		err = UnindexBlockExternalIDs(b)
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range b.EntryList {
+		err := DeleteEntry(v.Hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := DeleteData(BlocksBucket, b.PartialHash)
+	if err != nil {
+		return err
+	}
+	Blocks.Delete(b.PartialHash)
+	Blocks.Delete(b.FullHash)
+
+	err = DeleteBlockIndex(b.FullHash)
+	if err != nil {
+		return err
+	}
+	err = DeleteBlockIndex(b.PartialHash)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func SaveEntry(e *Entry) error {
 	err := SaveData(EntriesBucket, e.Hash, e)
 	if err != nil {
 		return err
 	}
-	Entries[e.Hash] = e
+	Entries.Set(e.Hash, e)
 	return nil
 }
 
 func LoadEntry(hash string) (*Entry, error) {
-	entry, found := Entries[hash]
+	cached, found := Entries.Get(hash)
 	if found == true {
-		return entry, nil
+		return cached.(*Entry), nil
 	}
 
-	entry = new(Entry)
+	entry := new(Entry)
 	entry2, err := LoadData(EntriesBucket, hash, entry)
 	if err != nil {
 		return nil, err
@@ -414,28 +679,37 @@ func LoadEntry(hash string) (*Entry, error) {
 	if entry2 == nil {
 		return nil, nil
 	}
-	Entries[hash] = entry
+	Entries.Set(hash, entry)
 	return entry, nil
 }
 
+func DeleteEntry(hash string) error {
+	err := DeleteData(EntriesBucket, hash)
+	if err != nil {
+		return err
+	}
+	Entries.Delete(hash)
+	return nil
+}
+
 func SaveChainIDsByName(chainID, decodedName, encodedName string) error {
 	err := SaveData(ChainIDsByDecodedNameBucket, decodedName, chainID)
 	if err != nil {
 		return err
 	}
-	ChainIDsByDecodedName[decodedName] = chainID
+	ChainIDsByDecodedName.Set(decodedName, chainID)
 	err = SaveData(ChainIDsByEncodedNameBucket, encodedName, chainID)
 	if err != nil {
 		return err
 	}
-	ChainIDsByEncodedName[encodedName] = chainID
+	ChainIDsByEncodedName.Set(encodedName, chainID)
 	return nil
 }
 
 func LoadChainIDByName(name string) (string, error) {
-	id, found := ChainIDsByDecodedName[name]
+	id, found := ChainIDsByDecodedName.Get(name)
 	if found == true {
-		return id, nil
+		return id.(string), nil
 	}
 
 	entry := new(string)
@@ -444,13 +718,13 @@ func LoadChainIDByName(name string) (string, error) {
 		return "", err
 	}
 	if entry2 != nil {
-		ChainIDsByDecodedName[name] = *entry
+		ChainIDsByDecodedName.Set(name, *entry)
 		return *entry, nil
 	}
 
-	id, found = ChainIDsByEncodedName[name]
+	id, found = ChainIDsByEncodedName.Get(name)
 	if found == true {
-		return id, nil
+		return id.(string), nil
 	}
 
 	entry = new(string)
@@ -459,7 +733,7 @@ func LoadChainIDByName(name string) (string, error) {
 		return "", err
 	}
 	if entry2 != nil {
-		ChainIDsByEncodedName[name] = *entry
+		ChainIDsByEncodedName.Set(name, *entry)
 		return *entry, nil
 	}
 
@@ -467,11 +741,20 @@ func LoadChainIDByName(name string) (string, error) {
 }
 
 func SaveChain(c *Chain) error {
-	err := SaveData(ChainsBucket, c.ChainID, c)
+	old, err := LoadChain(c.ChainID)
+	if err != nil {
+		return err
+	}
+	err = SaveData(ChainsBucket, c.ChainID, c)
+	if err != nil {
+		return err
+	}
+	Chains.Set(c.ChainID, c)
+
+	err = saveChainOrders(old, c)
 	if err != nil {
 		return err
 	}
-	Chains[c.ChainID] = c
 
 	for _, v := range c.Names {
 		err = SaveChainIDsByName(c.ChainID, v.Decoded, v.Encoded)
@@ -484,34 +767,183 @@ func SaveChain(c *Chain) error {
 }
 
 func LoadChain(hash string) (*Chain, error) {
-	chain, found := Chains[hash]
+	cached, found := Chains.Get(hash)
 	if found == true {
-		return chain, nil
+		return cached.(*Chain), nil
 	}
 
-	chain = new(Chain)
-	var err error
-	_, err = LoadData(ChainsBucket, hash, chain)
+	chain := new(Chain)
+	chain2, err := LoadData(ChainsBucket, hash, chain)
 	if err != nil {
 		return nil, err
 	}
-	Chains[hash] = chain
+	if chain2 == nil {
+		return nil, nil
+	}
+	Chains.Set(hash, chain)
 	return chain, nil
 }
 
+// chainOrderKeys returns the keys a chain is listed under in every sort
+// order. Counts and heights sorted newest or largest first are inverted, and
+// the chain ID breaks ties.
+func chainOrderKeys(c *Chain) []string {
+	return []string{
+		fmt.Sprintf("%v|%016x|%v", ChainSortCreated, uint64(c.FirstDBlockHeight), c.ChainID),
+		fmt.Sprintf("%v|%016x|%v", ChainSortEntries, ^uint64(c.EntryCount), c.ChainID),
+		fmt.Sprintf("%v|%016x|%v", ChainSortActivity, ^uint64(c.LastDBlockHeight), c.ChainID),
+	}
+}
+
+// saveChainOrders moves a chain to its new place in every sort order.
+func saveChainOrders(old, c *Chain) error {
+	keys := chainOrderKeys(c)
+	if old != nil {
+		for i, v := range chainOrderKeys(old) {
+			if v == keys[i] {
+				continue
+			}
+			err := DeleteIndexKey(ChainOrdersBucket, v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	//Keys are saved even when unchanged, so chains stored before the sort
+	//orders existed get listed as soon as they are updated
+	for _, v := range keys {
+		err := SaveIndexKey(ChainOrdersBucket, v, c.ChainID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteChain removes the chain along with its name indexes and sort orders.
+func DeleteChain(c *Chain) error {
+	for _, v := range chainOrderKeys(c) {
+		err := DeleteIndexKey(ChainOrdersBucket, v)
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range c.Names {
+		err := DeleteData(ChainIDsByDecodedNameBucket, v.Decoded)
+		if err != nil {
+			return err
+		}
+		ChainIDsByDecodedName.Delete(v.Decoded)
+		err = DeleteData(ChainIDsByEncodedNameBucket, v.Encoded)
+		if err != nil {
+			return err
+		}
+		ChainIDsByEncodedName.Delete(v.Encoded)
+	}
+
+	err := DeleteData(ChainsBucket, c.ChainID)
+	if err != nil {
+		return err
+	}
+	Chains.Delete(c.ChainID)
+	return nil
+}
+
+func SaveChainHead(chainID, keyMR string) error {
+	err := SaveData(ChainHeadsBucket, chainID, keyMR)
+	if err != nil {
+		return err
+	}
+	ChainHeads.Set(chainID, keyMR)
+	return nil
+}
+
+func LoadChainHead(chainID string) (string, error) {
+	head, found := ChainHeads.Get(chainID)
+	if found == true {
+		return head.(string), nil
+	}
+
+	key := new(string)
+	key2, err := LoadData(ChainHeadsBucket, chainID, key)
+	if err != nil {
+		return "", err
+	}
+	if key2 == nil {
+		return "", nil
+	}
+	ChainHeads.Set(chainID, *key)
+	return *key, nil
+}
+
+func DeleteChainHead(chainID string) error {
+	err := DeleteData(ChainHeadsBucket, chainID)
+	if err != nil {
+		return err
+	}
+	ChainHeads.Delete(chainID)
+	return nil
+}
+
+func SaveAnchorTransaction(txID, keyMR string) error {
+	err := SaveData(AnchorTransactionsBucket, txID, keyMR)
+	if err != nil {
+		return err
+	}
+	AnchorTransactions.Set(txID, keyMR)
+	return nil
+}
+
+func LoadDBlockKeyMRByAnchorTransaction(txID string) (string, error) {
+	keyMR, found := AnchorTransactions.Get(txID)
+	if found == true {
+		return keyMR.(string), nil
+	}
+
+	key := new(string)
+	key2, err := LoadData(AnchorTransactionsBucket, txID, key)
+	if err != nil {
+		return "", err
+	}
+	if key2 == nil {
+		return "", nil
+	}
+	AnchorTransactions.Set(txID, *key)
+	return *key, nil
+}
+
+func DeleteAnchorTransaction(txID string) error {
+	err := DeleteData(AnchorTransactionsBucket, txID)
+	if err != nil {
+		return err
+	}
+	AnchorTransactions.Delete(txID)
+	return nil
+}
+
 func SaveDataStatus(ds *DataStatusStruct) error {
 	err := SaveData(DataStatusBucket, DataStatusBucket, ds)
 	if err != nil {
 		return err
 	}
-	DataStatus = ds
+	saved := *ds
+	dataStatusMutex.Lock()
+	DataStatus = &saved
+	dataStatusMutex.Unlock()
 	return nil
 }
 
+// LoadDataStatus returns a copy of the current DataStatus. Changes to it only
+// take effect once it is saved with SaveDataStatus.
 func LoadDataStatus() *DataStatusStruct {
+	dataStatusMutex.Lock()
 	if DataStatus != nil {
-		return DataStatus
+		answer := *DataStatus
+		dataStatusMutex.Unlock()
+		return &answer
 	}
+	dataStatusMutex.Unlock()
+
 	ds := new(DataStatusStruct)
 	var err error
 	ds2, err := LoadData(DataStatusBucket, DataStatusBucket, ds)
@@ -523,13 +955,65 @@ func LoadDataStatus() *DataStatusStruct {
 		ds.LastKnownBlock = "0000000000000000000000000000000000000000000000000000000000000000"
 		ds.LastProcessedBlock = "0000000000000000000000000000000000000000000000000000000000000000"
 	}
-	DataStatus = ds
 	log.Printf("LoadDataStatus DS - %v, %v", ds, ds2)
-	return ds
+
+	dataStatusMutex.Lock()
+	defer dataStatusMutex.Unlock()
+	if DataStatus == nil {
+		DataStatus = ds
+	}
+	answer := *DataStatus
+	return &answer
+}
+
+func SaveReorgEvent(r *ReorgEvent) error {
+	return SaveData(ReorgsBucket, r.Time.UTC().Format(time.RFC3339Nano), r)
+}
+
+// LoadReorgEvents returns every recorded reorganization, oldest first.
+func LoadReorgEvents() ([]*ReorgEvent, error) {
+	keys, err := LoadKeys(ReorgsBucket)
+	if err != nil {
+		return nil, err
+	}
+	answer := []*ReorgEvent{}
+	for _, v := range keys {
+		r := new(ReorgEvent)
+		r2, err := LoadData(ReorgsBucket, v, r)
+		if err != nil {
+			return nil, err
+		}
+		if r2 == nil {
+			continue
+		}
+		answer = append(answer, r)
+	}
+	return answer, nil
+}
+
+func RecordSyncError(syncErr error) error {
+	ds := LoadDataStatus()
+	ds.LastError = syncErr.Error()
+	ds.LastErrorTime = time.Now()
+	ds.FailedAttempts++
+	return SaveDataStatus(ds)
+}
+
+func RecordSyncSuccess() error {
+	ds := LoadDataStatus()
+	ds.LastError = ""
+	ds.LastSyncTime = time.Now()
+	ds.FailedAttempts = 0
+	return SaveDataStatus(ds)
 }
 
 //Getters
 
+// GetDataStatus returns a copy of the current DataStatus, safe to hand to templates.
+func GetDataStatus() DataStatusStruct {
+	return *LoadDataStatus()
+}
+
 func GetBlock(hash string) (*Block, error) {
 	hash = strings.ToLower(hash)
 
@@ -609,13 +1093,39 @@ func GetDBInfo(keyMR string) (DBInfo, error) {
 	return DBInfo{}, nil
 }
 
-func GetChains() ([]*Chain, error) {
-	//TODO: load chains from database
+const ChainSortCreated string = "created"
+const ChainSortEntries string = "entries"
+const ChainSortActivity string = "activity"
+
+// GetChains returns up to max chains, skipping the first start of them, along
+// with the total number of chains. They are sorted oldest first by default,
+// by most entries for ChainSortEntries or by most recent activity for
+// ChainSortActivity, from the sort orders kept up to date as chains are saved.
+func GetChains(sortBy string, start, max int) ([]*Chain, int, error) {
+	switch sortBy {
+	case "":
+		sortBy = ChainSortCreated
+	case ChainSortCreated, ChainSortEntries, ChainSortActivity:
+	default:
+		return nil, 0, fmt.Errorf("Unknown chain sort order %v", sortBy)
+	}
+
+	keys, _, total, err := LoadIndexKeys(ChainOrdersBucket, sortBy+"|", start, max, false)
+	if err != nil {
+		return nil, 0, err
+	}
 	answer := []*Chain{}
-	for _, v := range Chains {
-		answer = append(answer, v)
+	for _, v := range keys {
+		chain, err := LoadChain(v[strings.LastIndex(v, "|")+1:])
+		if err != nil {
+			return nil, 0, err
+		}
+		if chain == nil {
+			continue
+		}
+		answer = append(answer, chain)
 	}
-	return answer, nil
+	return answer, total, nil
 }
 
 func GetChain(hash string) (*Chain, error) {
@@ -627,6 +1137,8 @@ func GetChain(hash string) (*Chain, error) {
 	if chain == nil {
 		return chain, errors.New("Chain not found")
 	}
+	chainCopy := *chain
+	chain = &chainCopy
 	entry, err := LoadEntry(chain.FirstEntryID)
 	if err != nil {
 		return nil, err
@@ -638,6 +1150,76 @@ func GetChain(hash string) (*Chain, error) {
 	return chain, nil
 }
 
+// GetChainHeadKeyMR returns the KeyMR of the newest entry block of a chain.
+// Chains synchronized before the ChainHeads index existed are looked up in
+// the DBlock the chain was last written in.
+func GetChainHeadKeyMR(chain *Chain) (string, error) {
+	head, err := LoadChainHead(chain.ChainID)
+	if err != nil {
+		return "", err
+	}
+	if head != "" {
+		return head, nil
+	}
+
+	dBlock, err := LoadDBlockBySequence(chain.LastDBlockHeight)
+	if err != nil {
+		return "", err
+	}
+	if dBlock == nil {
+		return "", nil
+	}
+	for _, v := range dBlock.EntryBlockList {
+		if v.ChainID == chain.ChainID {
+			return v.KeyMR, nil
+		}
+	}
+	return "", nil
+}
+
+// GetChainHistory walks a chain back from its head and returns up to max of
+// its entries, newest first, skipping the first start of them. Entries are
+// returned grouped in copies of the entry blocks they belong to.
+func GetChainHistory(chain *Chain, start, max int) ([]*Block, error) {
+	keyMR, err := GetChainHeadKeyMR(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := []*Block{}
+	skipped := 0
+	collected := 0
+	for keyMR != "" && IsHashZeroes(keyMR) == false && collected < max {
+		block, err := LoadBlock(keyMR)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, fmt.Errorf("Entry block %v of chain %v not found", keyMR, chain.ChainID)
+		}
+		keyMR = block.PrevBlockHash
+
+		if skipped+len(block.EntryList) <= start {
+			skipped += len(block.EntryList)
+			continue
+		}
+
+		entries := []*Entry{}
+		for i := len(block.EntryList) - 1; i >= 0 && collected < max; i-- {
+			if skipped < start {
+				skipped++
+				continue
+			}
+			entries = append(entries, block.EntryList[i])
+			collected++
+		}
+		blockCopy := *block
+		blockCopy.EntryList = entries
+		answer = append(answer, &blockCopy)
+	}
+	return answer, nil
+}
+
 func GetChainByName(name string) (*Chain, error) {
 	id, err := LoadChainIDByName(name)
 	if err != nil {
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetChainsSorting(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	chains := []*Chain{
+		&Chain{ChainID: "a", FirstDBlockHeight: 5, LastDBlockHeight: 6, EntryCount: 1},
+		&Chain{ChainID: "b", FirstDBlockHeight: 1, LastDBlockHeight: 9, EntryCount: 3},
+		&Chain{ChainID: "c", FirstDBlockHeight: 3, LastDBlockHeight: 4, EntryCount: 7},
+	}
+	for _, v := range chains {
+		err := SaveChain(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		ChainSortCreated:  "bca",
+		ChainSortEntries:  "cba",
+		ChainSortActivity: "bac",
+	}
+	for sortBy, order := range expected {
+		sorted, total, err := GetChains(sortBy, 0, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		for _, v := range sorted {
+			got += v.ChainID
+		}
+		if got != order || total != 3 {
+			t.Errorf("Sorting by %v gave %v of %v, expected %v", sortBy, got, total, order)
+		}
+	}
+
+	//Updated chains move within the sort orders
+	updated := *chains[0]
+	updated.EntryCount = 10
+	err := SaveChain(&updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted, total, err := GetChains(ChainSortEntries, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sorted) != 1 || sorted[0].ChainID != "c" || total != 3 {
+		t.Errorf("Wrong page after update - %v of %v", sorted, total)
+	}
+
+	_, _, err = GetChains("unknown", 0, 50)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown sort order")
+	}
+}
+
+// saveTestEntryBlock stores an entry block of the chain with the given entries
+// and a DBlock at the given height referencing it.
+func saveTestEntryBlock(t *testing.T, chainID, keyMR, prev string, height int, entries ...string) *Block {
+	block := new(Block)
+	block.ChainID = chainID
+	block.PartialHash = keyMR
+	block.FullHash = keyMR + "full"
+	block.PrevBlockHash = prev
+	block.DBlockHeight = height
+	block.IsEntryBlock = true
+	for _, v := range entries {
+		e := new(Entry)
+		e.Hash = v
+		e.ChainID = chainID
+		e.BinaryString = "0011"
+		e.ExternalIDs = []DecodedString{}
+		block.EntryList = append(block.EntryList, e)
+	}
+	block.EntryCount = len(block.EntryList)
+	err := SaveBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveChainHead(chainID, keyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UpdateChainStats(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dBlock := new(DBlock)
+	dBlock.KeyMR = fmt.Sprintf("d%v", height)
+	dBlock.SequenceNumber = height
+	dBlock.EntryBlockList = []ListEntry{ListEntry{ChainID: chainID, KeyMR: keyMR}}
+	err = SaveDBlock(dBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestGetChainHistory(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	saveTestEntryBlock(t, "c", "b1", zeroHash, 1, "e1", "e2")
+	saveTestEntryBlock(t, "c", "b2", "b1", 2, "e3")
+	saveTestEntryBlock(t, "c", "b3", "b2", 4, "e4", "e5", "e6")
+
+	chain, err := LoadChain("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.EntryCount != 6 || chain.FirstDBlockHeight != 1 || chain.LastDBlockHeight != 4 || chain.TotalBytes != 12 {
+		t.Errorf("Wrong chain stats - %v", chain)
+	}
+
+	history := func(start, max int) string {
+		blocks, err := GetChainHistory(chain, start, max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer := ""
+		for _, b := range blocks {
+			answer += "|" + b.PartialHash + ":"
+			for _, e := range b.EntryList {
+				answer += e.Hash
+			}
+		}
+		return answer
+	}
+
+	if h := history(0, 10); h != "|b3:e6e5e4|b2:e3|b1:e2e1" {
+		t.Errorf("Wrong full history - %v", h)
+	}
+	if h := history(2, 2); h != "|b3:e4|b2:e3" {
+		t.Errorf("Wrong history page - %v", h)
+	}
+	if h := history(3, 2); h != "|b2:e3|b1:e2" {
+		t.Errorf("Wrong history page - %v", h)
+	}
+	if h := history(6, 2); h != "" {
+		t.Errorf("Expected an empty page - %v", h)
+	}
+
+	block, err := LoadBlock("b3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.EntryList) != 3 {
+		t.Errorf("History trimmed the stored block - %v", len(block.EntryList))
+	}
+}
+
+func TestChainHeads(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	saveTestEntryBlock(t, "c", "b1", zeroHash, 1, "e1")
+	saveTestEntryBlock(t, "c", "b2", "b1", 2, "e2", "e3")
+
+	chain, err := LoadChain("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.HeadKeyMR != "b2" || chain.EntryBlockCount != 2 {
+		t.Errorf("Wrong chain head stats - %v", chain)
+	}
+	head, err := GetChainHeadKeyMR(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != "b2" {
+		t.Errorf("Wrong chain head - %v", head)
+	}
+
+	block, err := LoadBlock("b2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RollbackBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err = LoadChainHead("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != "b1" {
+		t.Errorf("Wrong chain head after rollback - %v", head)
+	}
+	chain, err = LoadChain("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.HeadKeyMR != "b1" || chain.EntryBlockCount != 1 || chain.EntryCount != 1 {
+		t.Errorf("Wrong chain stats after rollback - %v", chain)
+	}
+
+	block, err = LoadBlock("b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RollbackBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err = LoadChainHead("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != "" {
+		t.Errorf("Chain head not removed - %v", head)
+	}
+}
+
+func TestCachedValuesAreNotChanged(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	ds := LoadDataStatus()
+	ds.DBlockHeight = 5
+	if GetBlockHeight() != 0 {
+		t.Errorf("DataStatus changed before it was saved")
+	}
+	err := SaveDataStatus(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.DBlockHeight = 6
+	if GetBlockHeight() != 5 {
+		t.Errorf("Saved DataStatus changed - %v", GetBlockHeight())
+	}
+
+	block := new(Block)
+	block.ChainID = "c1"
+	block.PartialHash = "b1"
+	block.EntryCount = 2
+	block.DBlockHeight = 1
+	cached := &Chain{ChainID: "c1", EntryCount: 3}
+	err = SaveChain(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UpdateChainStats(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.EntryCount != 3 {
+		t.Errorf("Cached chain was changed in place")
+	}
+	chain, err := LoadChain("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.EntryCount != 5 {
+		t.Errorf("Chain stats were not saved - %v", chain.EntryCount)
+	}
+}
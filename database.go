@@ -6,12 +6,30 @@ import (
 	"fmt"
 	"github.com/boltdb/bolt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 )
 
 const DatabaseFile string = "FactomExplorer.db"
 
 var db *bolt.DB
 
+// batch holds the writes of the batch in progress, by bucket and key. A nil
+// value marks a deleted key. It is nil when no batch is in progress.
+var batch map[string]map[string][]byte
+var batchMutex sync.RWMutex
+
+// storeMutex is held for writing by RunInBatch for the whole batch and for
+// reading by the HTTP handlers, so the held writes, and the caches that may
+// already hold them, are only ever seen by the goroutine running the batch.
+var storeMutex sync.RWMutex
+
+// memoryIndexes holds the keys of ordered indexes by bucket when there is no
+// database, as the caches cannot be scanned in order.
+var memoryIndexes map[string]map[string][]byte = map[string]map[string][]byte{}
+var memoryIndexesMutex sync.RWMutex
+
 func Init(filePath string) {
 	var err error
 	db, err = bolt.Open(filePath+DatabaseFile, 0600, nil)
@@ -37,7 +55,14 @@ func LoadData(bucket, key string, dst interface{}) (interface{}, error) {
 		return nil, nil
 	}
 
-	var v []byte
+	v, pending := loadPending(bucket, key)
+	if pending == true {
+		if v == nil {
+			return nil, nil
+		}
+		return decodeData(bucket, key, v, dst)
+	}
+
 	err := db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucket))
 		v1 := b.Get([]byte(key))
@@ -56,8 +81,12 @@ func LoadData(bucket, key string, dst interface{}) (interface{}, error) {
 		return nil, nil
 	}
 
+	return decodeData(bucket, key, v, dst)
+}
+
+func decodeData(bucket, key string, v []byte, dst interface{}) (interface{}, error) {
 	dec := gob.NewDecoder(bytes.NewBuffer(v))
-	err = dec.Decode(dst)
+	err := dec.Decode(dst)
 	if err != nil {
 		log.Printf("Error decoding %v of %v", bucket, key)
 		return nil, err
@@ -66,23 +95,35 @@ func LoadData(bucket, key string, dst interface{}) (interface{}, error) {
 	return dst, nil
 }
 
-func SaveData(bucket, key string, toStore interface{}) error {
-	if cfg.UseDatabase == false {
-		return nil
-	}
-
+func encodeData(toStore interface{}) ([]byte, error) {
 	var data bytes.Buffer
 
 	enc := gob.NewEncoder(&data)
 
 	err := enc.Encode(toStore)
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+func SaveData(bucket, key string, toStore interface{}) error {
+	if cfg.UseDatabase == false {
+		return nil
+	}
+
+	data, err := encodeData(toStore)
 	if err != nil {
 		return err
 	}
 
+	if savePending(bucket, key, data) == true {
+		return nil
+	}
+
 	err = db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucket))
-		err := b.Put([]byte(key), data.Bytes())
+		err := b.Put([]byte(key), data)
 		return err
 	})
 	if err != nil {
@@ -92,3 +133,493 @@ func SaveData(bucket, key string, toStore interface{}) error {
 
 	return nil
 }
+
+func DeleteData(bucket, key string) error {
+	if cfg.UseDatabase == false {
+		return nil
+	}
+
+	if savePending(bucket, key, nil) == true {
+		return nil
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		return b.Delete([]byte(key))
+	})
+	if err != nil {
+		log.Printf("Error deleting %v of %v", bucket, key)
+		return err
+	}
+
+	return nil
+}
+
+// LoadKeys returns every key stored in the bucket, in byte-sorted order.
+func LoadKeys(bucket string) ([]string, error) {
+	if cfg.UseDatabase == false {
+		return nil, nil
+	}
+
+	keys := []string{}
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		return b.ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("Error loading keys of %v", bucket)
+		return nil, err
+	}
+
+	batchMutex.RLock()
+	defer batchMutex.RUnlock()
+	pending := batch[bucket]
+	if len(pending) == 0 {
+		return keys, nil
+	}
+	answer := []string{}
+	for _, v := range keys {
+		if value, found := pending[v]; found == true && value == nil {
+			continue
+		}
+		answer = append(answer, v)
+	}
+	for k, v := range pending {
+		if v == nil {
+			continue
+		}
+		i := sort.SearchStrings(answer, k)
+		if i < len(answer) && answer[i] == k {
+			continue
+		}
+		answer = append(answer, "")
+		copy(answer[i+1:], answer[i:])
+		answer[i] = k
+	}
+	return answer, nil
+}
+
+// HasData reports whether the bucket holds the key, without decoding it.
+func HasData(bucket, key string) (bool, error) {
+	if cfg.UseDatabase == false {
+		return false, nil
+	}
+
+	v, pending := loadPending(bucket, key)
+	if pending == true {
+		return v != nil, nil
+	}
+
+	found := false
+	err := db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(bucket)).Get([]byte(key)) != nil
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error loading %v of %v", bucket, key)
+		return false, err
+	}
+	return found, nil
+}
+
+// ScanBucket calls f with every key and value stored in the bucket, in
+// byte-sorted order. Keys are read with a cursor a chunk at a time, outside of
+// which f runs, so f can read from and write to the database. Writes held by
+// a batch in progress are not seen.
+func ScanBucket(bucket string, f func(key string, v []byte) error) error {
+	if cfg.UseDatabase == false {
+		return nil
+	}
+
+	const chunkSize int = 1000
+	var last []byte
+	for {
+		keys := []string{}
+		values := [][]byte{}
+		err := db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket([]byte(bucket)).Cursor()
+			var k, v []byte
+			if last == nil {
+				k, v = c.First()
+			} else {
+				k, v = c.Seek(last)
+				if k != nil && bytes.Equal(k, last) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && len(keys) < chunkSize; k, v = c.Next() {
+				keys = append(keys, string(k))
+				values = append(values, append([]byte{}, v...))
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error loading keys of %v", bucket)
+			return err
+		}
+		for i := range keys {
+			err = f(keys[i], values[i])
+			if err != nil {
+				return err
+			}
+		}
+		if len(keys) < chunkSize {
+			return nil
+		}
+		last = []byte(keys[len(keys)-1])
+	}
+}
+
+// SaveIndexKey stores a key of an ordered index along with its value. Index
+// keys are meant to be read with LoadIndexKeys, so they are kept in memory
+// when there is no database.
+func SaveIndexKey(bucket, key string, toStore interface{}) error {
+	if cfg.UseDatabase == true {
+		return SaveData(bucket, key, toStore)
+	}
+
+	data, err := encodeData(toStore)
+	if err != nil {
+		return err
+	}
+	memoryIndexesMutex.Lock()
+	defer memoryIndexesMutex.Unlock()
+	if memoryIndexes[bucket] == nil {
+		memoryIndexes[bucket] = map[string][]byte{}
+	}
+	memoryIndexes[bucket][key] = data
+	return nil
+}
+
+// DeleteIndexKey removes a key of an ordered index.
+func DeleteIndexKey(bucket, key string) error {
+	if cfg.UseDatabase == true {
+		return DeleteData(bucket, key)
+	}
+
+	memoryIndexesMutex.Lock()
+	defer memoryIndexesMutex.Unlock()
+	delete(memoryIndexes[bucket], key)
+	return nil
+}
+
+// LoadIndexKey loads the value of a single key of an ordered index into dst,
+// returning nil if the key is not there.
+func LoadIndexKey(bucket, key string, dst interface{}) (interface{}, error) {
+	if cfg.UseDatabase == true {
+		return LoadData(bucket, key, dst)
+	}
+
+	memoryIndexesMutex.RLock()
+	v, found := memoryIndexes[bucket][key]
+	memoryIndexesMutex.RUnlock()
+	if found == false {
+		return nil, nil
+	}
+	return decodeData(bucket, key, v, dst)
+}
+
+// ClearMemoryIndexes drops the index keys kept in memory without a database.
+func ClearMemoryIndexes() {
+	memoryIndexesMutex.Lock()
+	defer memoryIndexesMutex.Unlock()
+	memoryIndexes = map[string]map[string][]byte{}
+}
+
+// LoadIndexKeys returns up to max of the keys of a bucket starting with
+// prefix along with their encoded values, skipping the first start of them,
+// and the total number of keys starting with prefix. Keys are returned in
+// byte order, or in reverse. A negative max returns every key after start.
+// Values are decoded with DecodeIndexValue.
+func LoadIndexKeys(bucket, prefix string, start, max int, reverse bool) ([]string, [][]byte, int, error) {
+	if cfg.UseDatabase == false {
+		memoryIndexesMutex.RLock()
+		defer memoryIndexesMutex.RUnlock()
+		return pageIndexKeys(memoryIndexes[bucket], prefix, start, max, reverse)
+	}
+
+	pending := loadPendingWithPrefix(bucket, prefix)
+	if len(pending) == 0 {
+		return scanIndexKeys(bucket, prefix, start, max, reverse)
+	}
+
+	//Merge the writes of the batch in progress with everything stored
+	keys, values, _, err := scanIndexKeys(bucket, prefix, 0, -1, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	merged := map[string][]byte{}
+	for i, k := range keys {
+		merged[k] = values[i]
+	}
+	for k, v := range pending {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	return pageIndexKeys(merged, prefix, start, max, reverse)
+}
+
+// LoadLastIndexKey returns the last key of a bucket starting with prefix that
+// sorts before limit, along with its encoded value, or an empty key if there
+// is none.
+func LoadLastIndexKey(bucket, prefix, limit string) (string, []byte, error) {
+	if cfg.UseDatabase == false || len(loadPendingWithPrefix(bucket, prefix)) > 0 {
+		keys, values, _, err := LoadIndexKeys(bucket, prefix, 0, -1, true)
+		if err != nil {
+			return "", nil, err
+		}
+		for i, v := range keys {
+			if v < limit {
+				return v, values[i], nil
+			}
+		}
+		return "", nil, nil
+	}
+
+	var key string
+	var value []byte
+	err := db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		k, v := c.Seek([]byte(limit))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		if k != nil && bytes.HasPrefix(k, []byte(prefix)) {
+			key = string(k)
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error loading keys of %v starting with %v", bucket, prefix)
+		return "", nil, err
+	}
+	return key, value, nil
+}
+
+// DecodeIndexValue decodes a value returned by LoadIndexKeys into dst.
+func DecodeIndexValue(bucket, key string, v []byte, dst interface{}) (interface{}, error) {
+	return decodeData(bucket, key, v, dst)
+}
+
+// scanIndexKeys walks the keys starting with prefix with a cursor, only
+// copying the ones in the requested page.
+func scanIndexKeys(bucket, prefix string, start, max int, reverse bool) ([]string, [][]byte, int, error) {
+	keys := []string{}
+	values := [][]byte{}
+	total := 0
+	p := []byte(prefix)
+	err := db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		var k, v []byte
+		if reverse == false {
+			k, v = c.Seek(p)
+		} else {
+			k, v = seekLastWithPrefix(c, p)
+		}
+		for k != nil && bytes.HasPrefix(k, p) {
+			if total >= start && (max < 0 || total < start+max) {
+				keys = append(keys, string(k))
+				values = append(values, append([]byte{}, v...))
+			}
+			total++
+			if reverse == false {
+				k, v = c.Next()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error loading keys of %v starting with %v", bucket, prefix)
+		return nil, nil, 0, err
+	}
+	return keys, values, total, nil
+}
+
+// seekLastWithPrefix moves the cursor to the last key starting with prefix,
+// or to the key right before where it would be.
+func seekLastWithPrefix(c *bolt.Cursor, prefix []byte) ([]byte, []byte) {
+	//The first key past every key starting with prefix
+	end := append([]byte{}, prefix...)
+	for len(end) > 0 && end[len(end)-1] == 0xff {
+		end = end[:len(end)-1]
+	}
+	if len(end) == 0 {
+		return c.Last()
+	}
+	end[len(end)-1]++
+	k, _ := c.Seek(end)
+	if k == nil {
+		return c.Last()
+	}
+	return c.Prev()
+}
+
+func pageIndexKeys(all map[string][]byte, prefix string, start, max int, reverse bool) ([]string, [][]byte, int, error) {
+	matching := []string{}
+	for k := range all {
+		if strings.HasPrefix(k, prefix) {
+			matching = append(matching, k)
+		}
+	}
+	if reverse == false {
+		sort.Strings(matching)
+	} else {
+		sort.Sort(sort.Reverse(sort.StringSlice(matching)))
+	}
+
+	keys := []string{}
+	values := [][]byte{}
+	for i := start; i < len(matching) && (max < 0 || i < start+max); i++ {
+		keys = append(keys, matching[i])
+		values = append(values, all[matching[i]])
+	}
+	return keys, values, len(matching), nil
+}
+
+// StartBatch makes SaveData and DeleteData hold their writes in memory until
+// CommitBatch stores them all in a single transaction, or AbortBatch drops
+// them. Every read sees the held writes, from any goroutine - use RunInBatch,
+// which keeps the HTTP handlers out until the batch is over, unless nothing
+// else reads the database.
+func StartBatch() error {
+	if cfg.UseDatabase == false {
+		return nil
+	}
+
+	batchMutex.Lock()
+	defer batchMutex.Unlock()
+	if batch != nil {
+		return fmt.Errorf("A batch is already in progress")
+	}
+	batch = map[string]map[string][]byte{}
+	return nil
+}
+
+// CommitBatch stores the writes of the batch in progress in one transaction.
+// If that fails, nothing is stored and the batch is aborted.
+func CommitBatch() error {
+	if cfg.UseDatabase == false {
+		return nil
+	}
+
+	batchMutex.Lock()
+	defer batchMutex.Unlock()
+	if batch == nil {
+		return fmt.Errorf("No batch is in progress")
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		for bucket, pending := range batch {
+			b := tx.Bucket([]byte(bucket))
+			for k, v := range pending {
+				var err error
+				if v == nil {
+					err = b.Delete([]byte(k))
+				} else {
+					err = b.Put([]byte(k), v)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error committing batch - %v", err)
+		abortBatch()
+		return err
+	}
+	batch = nil
+	return nil
+}
+
+// AbortBatch drops the writes of the batch in progress. The caches may hold
+// some of them, so they are cleared as well.
+func AbortBatch() {
+	if cfg.UseDatabase == false {
+		return
+	}
+
+	batchMutex.Lock()
+	defer batchMutex.Unlock()
+	abortBatch()
+}
+
+func abortBatch() {
+	if len(batch) > 0 {
+		ClearCaches()
+	}
+	batch = nil
+}
+
+// RunInBatch runs f in a batch, committing its writes if it succeeds and
+// dropping them if it fails. Readers holding ReadLock wait until it is over,
+// so f should not fetch anything from the network.
+func RunInBatch(f func() error) error {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	err := StartBatch()
+	if err != nil {
+		return err
+	}
+	err = f()
+	if err != nil {
+		AbortBatch()
+		return err
+	}
+	return CommitBatch()
+}
+
+// ReadLock keeps batches from starting until ReadUnlock is called, so
+// everything read in between is committed data.
+func ReadLock() {
+	storeMutex.RLock()
+}
+
+func ReadUnlock() {
+	storeMutex.RUnlock()
+}
+
+func loadPending(bucket, key string) ([]byte, bool) {
+	batchMutex.RLock()
+	defer batchMutex.RUnlock()
+	v, found := batch[bucket][key]
+	return v, found
+}
+
+func loadPendingWithPrefix(bucket, prefix string) map[string][]byte {
+	batchMutex.RLock()
+	defer batchMutex.RUnlock()
+	answer := map[string][]byte{}
+	for k, v := range batch[bucket] {
+		if strings.HasPrefix(k, prefix) {
+			answer[k] = v
+		}
+	}
+	return answer
+}
+
+func savePending(bucket, key string, v []byte) bool {
+	batchMutex.Lock()
+	defer batchMutex.Unlock()
+	if batch == nil {
+		return false
+	}
+	if batch[bucket] == nil {
+		batch[bucket] = map[string][]byte{}
+	}
+	batch[bucket][key] = v
+	return true
+}
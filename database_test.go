@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func initTestDatabase(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "explorer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Init(dir + "/")
+	cfg.UseDatabase = true
+	return func() {
+		cfg.UseDatabase = false
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func storedKeys(t *testing.T, bucket string) []string {
+	keys := []string{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestBatchCommit(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	defer initTestDatabase(t)()
+
+	for _, v := range []string{"a", "c"} {
+		err := SaveBlockIndex(v, "block-"+v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := StartBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if StartBatch() == nil {
+		t.Errorf("Started a second batch")
+	}
+	err = SaveData(BlockIndexesBucket, "b", "block-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DeleteData(BlockIndexesBucket, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := storedKeys(t, BlockIndexesBucket); fmt.Sprint(keys) != "[a c]" {
+		t.Errorf("Batch writes were stored before the commit - %v", keys)
+	}
+	keys, err := LoadKeys(BlockIndexesBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[a b]" {
+		t.Errorf("LoadKeys returned %v", keys)
+	}
+	var value string
+	found, err := LoadData(BlockIndexesBucket, "b", &value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || value != "block-b" {
+		t.Errorf("LoadData returned %v", value)
+	}
+	found, err = LoadData(BlockIndexesBucket, "c", new(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != nil {
+		t.Errorf("LoadData returned a deleted key")
+	}
+
+	err = CommitBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := storedKeys(t, BlockIndexesBucket); fmt.Sprint(keys) != "[a b]" {
+		t.Errorf("Stored keys are %v", keys)
+	}
+	if CommitBatch() == nil {
+		t.Errorf("Committed a batch that was not started")
+	}
+}
+
+func TestRunInBatchFailure(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	defer initTestDatabase(t)()
+
+	err := RunInBatch(func() error {
+		err := SaveBlockIndex("a", "block-a")
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("Failed")
+	})
+	if err == nil || err.Error() != "Failed" {
+		t.Errorf("RunInBatch returned %v", err)
+	}
+	if keys := storedKeys(t, BlockIndexesBucket); len(keys) != 0 {
+		t.Errorf("A failed batch stored %v", keys)
+	}
+	if BlockIndexes.Len() != 0 {
+		t.Errorf("Caches were not cleared")
+	}
+	index, err := LoadBlockIndex("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != "" {
+		t.Errorf("Loaded %v from a failed batch", index)
+	}
+
+	err = RunInBatch(func() error {
+		return SaveBlockIndex("a", "block-a")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := storedKeys(t, BlockIndexesBucket); fmt.Sprint(keys) != "[a]" {
+		t.Errorf("Stored keys are %v", keys)
+	}
+}
+
+func TestRunInBatchExcludesReaders(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	defer initTestDatabase(t)()
+
+	started := make(chan bool)
+	release := make(chan bool)
+	done := make(chan error)
+	go func() {
+		done <- RunInBatch(func() error {
+			err := SaveBlockIndex("a", "block-a")
+			started <- true
+			<-release
+			return err
+		})
+	}()
+	<-started
+
+	read := make(chan string)
+	go func() {
+		ReadLock()
+		defer ReadUnlock()
+		index, err := LoadBlockIndex("a")
+		if err != nil {
+			t.Error(err)
+		}
+		read <- index
+	}()
+	select {
+	case index := <-read:
+		close(release)
+		<-done
+		t.Fatalf("Read %v while the batch was in progress", index)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index := <-read; index != "block-a" {
+		t.Errorf("Read %v after the batch was committed", index)
+	}
+}
+
+func TestLoadIndexKeys(t *testing.T) {
+	check := func(name string, reverse bool, start, max int, expected string, expectedTotal int) {
+		keys, values, total, err := LoadIndexKeys(ChainOrdersBucket, "p|", start, max, reverse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		for i, k := range keys {
+			var v string
+			_, err = DecodeIndexValue(ChainOrdersBucket, k, values[i], &v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got += v
+		}
+		if got != expected || total != expectedTotal {
+			t.Errorf("%v - got %v of %v, expected %v of %v", name, got, total, expected, expectedTotal)
+		}
+	}
+	save := func(keys ...string) {
+		for _, v := range keys {
+			err := SaveIndexKey(ChainOrdersBucket, v, v[len(v)-1:])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	resetTestData(NewFixtureClient())
+	save("p|1", "p|3", "p|2", "q|4", "o|5")
+	check("memory", false, 0, -1, "123", 3)
+	check("memory reversed", true, 1, 1, "2", 3)
+
+	defer initTestDatabase(t)()
+	save("p|1", "p|3", "p|2", "q|4", "o|5", "p\xff|6")
+	check("database", false, 0, -1, "123", 3)
+	check("database page", false, 1, 5, "23", 3)
+	check("database reversed", true, 0, 2, "32", 3)
+
+	err := StartBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer AbortBatch()
+	save("p|4")
+	err = DeleteIndexKey(ChainOrdersBucket, "p|1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("batch", false, 0, -1, "234", 3)
+	check("batch reversed", true, 0, 1, "4", 3)
+}
+
+func TestScanBucket(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	defer initTestDatabase(t)()
+
+	//More keys than fit in one chunk
+	err := RunInBatch(func() error {
+		for i := 0; i < 2500; i++ {
+			err := SaveData(CommitsBucket, fmt.Sprintf("%05d", i), "entry")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanned := 0
+	err = ScanBucket(CommitsBucket, func(key string, v []byte) error {
+		if key != fmt.Sprintf("%05d", scanned) {
+			t.Errorf("Key %v scanned as %v", key, scanned)
+		}
+		scanned++
+		//f can write to the database
+		if scanned == 2500 {
+			return DeleteData(CommitsBucket, key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanned != 2500 {
+		t.Errorf("Scanned %v keys", scanned)
+	}
+
+	found, err := HasData(CommitsBucket, "02499")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == true {
+		t.Errorf("Deleted key found")
+	}
+	found, err = HasData(CommitsBucket, "02498")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == false {
+		t.Errorf("Stored key not found")
+	}
+}
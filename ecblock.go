@@ -0,0 +1,212 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/factoid"
+)
+
+// ECEntry is a decoded entry credit block entry. Only the fields relevant to
+// its Type are set.
+type ECEntry struct {
+	Type string
+
+	//Chain and entry commits
+	Timestamp   string
+	EntryHash   string
+	ChainIDHash string
+	Weld        string
+	Credits     int
+
+	//Commits and balance increases
+	ECPubKey  string
+	ECAddress string
+
+	//Balance increases
+	TXID  string
+	Index uint64
+	NumEC uint64
+
+	//Minute numbers and server indexes
+	Number int
+}
+
+const ECEntryServerIndex string = "Server Index"
+const ECEntryMinuteNumber string = "Minute Number"
+const ECEntryChainCommit string = "Chain Commit"
+const ECEntryEntryCommit string = "Entry Commit"
+const ECEntryBalanceIncrease string = "Balance Increase"
+
+func (e *ECEntry) IsCommit() bool {
+	return e.Type == ECEntryChainCommit || e.Type == ECEntryEntryCommit
+}
+
+func ecAddressFromPubKey(pubKey *[32]byte) (string, string) {
+	return fmt.Sprintf("%x", pubKey[:]), factoid.ConvertECAddressToUserStr(factoid.NewAddress(pubKey[:]))
+}
+
+func milliTimeToString(milliTime *[6]byte) string {
+	var ms uint64
+	for _, v := range milliTime {
+		ms = ms<<8 | uint64(v)
+	}
+	return TimestampToString(ms / 1000)
+}
+
+// ParseECEntry decodes an entry credit block entry.
+func ParseECEntry(v common.ECBlockEntry) (*ECEntry, error) {
+	answer := new(ECEntry)
+	switch e := v.(type) {
+	case *common.ServerIndexNumber:
+		answer.Type = ECEntryServerIndex
+		answer.Number = int(e.Number)
+	case *common.MinuteNumber:
+		answer.Type = ECEntryMinuteNumber
+		answer.Number = int(e.Number)
+	case *common.CommitChain:
+		answer.Type = ECEntryChainCommit
+		answer.Timestamp = milliTimeToString(e.MilliTime)
+		answer.EntryHash = e.EntryHash.String()
+		answer.ChainIDHash = e.ChainIDHash.String()
+		answer.Weld = e.Weld.String()
+		answer.Credits = int(e.Credits)
+		answer.ECPubKey, answer.ECAddress = ecAddressFromPubKey(e.ECPubKey)
+	case *common.CommitEntry:
+		answer.Type = ECEntryEntryCommit
+		answer.Timestamp = milliTimeToString(e.MilliTime)
+		answer.EntryHash = e.EntryHash.String()
+		answer.Credits = int(e.Credits)
+		answer.ECPubKey, answer.ECAddress = ecAddressFromPubKey(e.ECPubKey)
+	case *common.IncreaseBalance:
+		answer.Type = ECEntryBalanceIncrease
+		answer.TXID = e.TXID.String()
+		answer.Index = e.Index
+		answer.NumEC = e.NumEC
+		answer.ECPubKey, answer.ECAddress = ecAddressFromPubKey(e.ECPubKey)
+	default:
+		return nil, fmt.Errorf("Unknown entry credit entry type %v", v.ECID())
+	}
+	return answer, nil
+}
+
+// ApplyECMinuteMarkers marks every entry of an entry credit block with the
+// minute it was included in. A minute number entry closes its minute.
+func ApplyECMinuteMarkers(b *Block) {
+	lastMarkedEntry := 0
+	for i, v := range b.EntryList {
+		if v.ECEntry == nil || v.ECEntry.Type != ECEntryMinuteNumber {
+			continue
+		}
+		for j := lastMarkedEntry; j < i; j++ {
+			b.EntryList[j].MinuteMarker = fmt.Sprintf("%v", v.ECEntry.Number)
+		}
+		lastMarkedEntry = i + 1
+	}
+}
+
+// UpdateECTotals sums up the credits spent on commits and bought in an
+// entry credit block.
+func UpdateECTotals(b *Block) {
+	b.ECSpent = 0
+	b.ECPurchased = 0
+	for _, v := range b.EntryList {
+		if v.ECEntry == nil {
+			continue
+		}
+		if v.ECEntry.IsCommit() {
+			b.ECSpent += v.ECEntry.Credits
+		}
+		if v.ECEntry.Type == ECEntryBalanceIncrease {
+			b.ECPurchased += int(v.ECEntry.NumEC)
+		}
+	}
+}
+
+// IndexBlockCommits records which commit paid for every entry committed in
+// an entry credit block.
+func IndexBlockCommits(b *Block) error {
+	for _, v := range b.EntryList {
+		if v.ECEntry == nil || v.ECEntry.IsCommit() == false {
+			continue
+		}
+		err := SaveCommitIndex(v.ECEntry.EntryHash, v.Hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func UnindexBlockCommits(b *Block) error {
+	for _, v := range b.EntryList {
+		if v.ECEntry == nil || v.ECEntry.IsCommit() == false {
+			continue
+		}
+		commit, err := LoadCommitIndex(v.ECEntry.EntryHash)
+		if err != nil {
+			return err
+		}
+		if commit != v.Hash {
+			continue
+		}
+		err = DeleteCommitIndex(v.ECEntry.EntryHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func SaveCommitIndex(entryHash, commitHash string) error {
+	err := SaveData(CommitsBucket, entryHash, commitHash)
+	if err != nil {
+		return err
+	}
+	Commits.Set(entryHash, commitHash)
+	return nil
+}
+
+func LoadCommitIndex(entryHash string) (string, error) {
+	hash, found := Commits.Get(entryHash)
+	if found == true {
+		return hash.(string), nil
+	}
+
+	key := new(string)
+	key2, err := LoadData(CommitsBucket, entryHash, key)
+	if err != nil {
+		return "", err
+	}
+	if key2 == nil {
+		return "", nil
+	}
+	Commits.Set(entryHash, *key)
+	return *key, nil
+}
+
+func DeleteCommitIndex(entryHash string) error {
+	err := DeleteData(CommitsBucket, entryHash)
+	if err != nil {
+		return err
+	}
+	Commits.Delete(entryHash)
+	return nil
+}
+
+// GetEntryCommit returns the entry credit block entry that paid for an entry,
+// or nil if we have not seen it.
+func GetEntryCommit(entryHash string) (*Entry, error) {
+	commitHash, err := LoadCommitIndex(entryHash)
+	if err != nil {
+		return nil, err
+	}
+	if commitHash == "" {
+		return nil, nil
+	}
+	return LoadEntry(commitHash)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+)
+
+func testECEntry(hash string, ecEntry *ECEntry) *Entry {
+	entry := new(Entry)
+	entry.Hash = hash
+	entry.ECEntry = ecEntry
+	return entry
+}
+
+func TestECBlockCommits(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	block := new(Block)
+	block.ChainID = "000000000000000000000000000000000000000000000000000000000000000c"
+	block.PartialHash = "ecb1"
+	block.FullHash = "fecb1"
+	block.PrevBlockHash = zeroHash
+	block.IsEntryCreditBlock = true
+	block.EntryList = []*Entry{
+		testECEntry("c1", &ECEntry{Type: ECEntryChainCommit, EntryHash: "e1", Credits: 11}),
+		testECEntry("b1", &ECEntry{Type: ECEntryBalanceIncrease, NumEC: 100}),
+		testECEntry("m1", &ECEntry{Type: ECEntryMinuteNumber, Number: 1}),
+		testECEntry("c2", &ECEntry{Type: ECEntryEntryCommit, EntryHash: "e2", Credits: 1}),
+		testECEntry("m2", &ECEntry{Type: ECEntryMinuteNumber, Number: 2}),
+	}
+
+	ApplyECMinuteMarkers(block)
+	if block.EntryList[0].MinuteMarker != "1" || block.EntryList[1].MinuteMarker != "1" {
+		t.Errorf("Wrong minute markers - %v, %v", block.EntryList[0].MinuteMarker, block.EntryList[1].MinuteMarker)
+	}
+	if block.EntryList[3].MinuteMarker != "2" {
+		t.Errorf("Wrong minute marker - %v", block.EntryList[3].MinuteMarker)
+	}
+
+	UpdateECTotals(block)
+	if block.ECSpent != 12 {
+		t.Errorf("Wrong credits spent - %v", block.ECSpent)
+	}
+	if block.ECPurchased != 100 {
+		t.Errorf("Wrong credits purchased - %v", block.ECPurchased)
+	}
+
+	for _, v := range block.EntryList {
+		err := SaveEntry(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := SaveBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = IndexBlockCommits(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := GetEntryCommit("e2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit == nil || commit.Hash != "c2" {
+		t.Errorf("Wrong commit - %v", commit)
+	}
+	commit, err = GetEntryCommit("e3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit != nil {
+		t.Errorf("Unexpected commit - %v", commit)
+	}
+
+	err = RollbackBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err = GetEntryCommit("e1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit != nil {
+		t.Errorf("Commit was not rolled back")
+	}
+}
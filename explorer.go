@@ -6,9 +6,11 @@ package main
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
+	"net/url"
 	"os"
 	//"io"
 	"strconv"
@@ -34,6 +36,10 @@ func main() {
 
 	Init(cfg.DatabaseDir)
 
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(RunCheck(os.Args[2:]))
+	}
+
 	server.Config.StaticDir, err = os.Getwd()
 	if err != nil {
 		log.Fatal(err)
@@ -63,24 +69,39 @@ func main() {
 		dir+"/views/pagination.html",
 		dir+"/views/entry.html",
 		dir+"/views/address.html",
+		dir+"/views/status.html",
+		dir+"/views/textsearch.html",
+		dir+"/views/search.html",
+		dir+"/views/tx.html",
+		dir+"/views/admin.html",
+		dir+"/views/anchors.html",
 	))
 
-	server.Get(`/(?:home)?`, handleHome)
-	server.Get(`/`, handleDBlocks)
-	server.Get(`/index.html`, handleDBlocks)
-	server.Get(`/chains/?`, handleChains)
-	server.Get(`/chain/([^/]+)?`, handleChain)
-	server.Get(`/dblocks/?`, handleDBlocks)
-	server.Get(`/dblock/([^/]+)?`, handleDBlock)
-	server.Get(`/eblock/([^/]+)?`, handleBlock)
-	server.Get(`/ablock/([^/]+)?`, handleBlock)
-	server.Get(`/ecblock/([^/]+)?`, handleBlock)
-	server.Get(`/fblock/([^/]+)?`, handleBlock)
-	server.Get(`/entry/([^/]+)?`, handleEntry)
-	server.Get(`/entry/([^/]+)?`, handleEntry)
-	server.Get(`/address/([^/]+)?`, handleAddress)
-	server.Post(`/search/?`, handleSearch)
+	server.Get(`/(?:home)?`, readLocked(handleHome))
+	server.Get(`/`, readLocked(handleDBlocks))
+	server.Get(`/index.html`, readLocked(handleDBlocks))
+	server.Get(`/chains/?`, readLocked(handleChains))
+	server.Get(`/chains/([^/]+)/?`, readLockedArg(handleChainsSorted))
+	server.Get(`/chain/([^/]+)?`, readLockedArg(handleChain))
+	server.Get(`/dblocks/?`, readLocked(handleDBlocks))
+	server.Get(`/dblock/height/([0-9]+)/?`, readLockedArg(handleDBlockHeight))
+	server.Get(`/dblock/([^/]+)?`, readLockedArg(handleDBlock))
+	server.Get(`/eblock/([^/]+)?`, readLockedArg(handleBlock))
+	server.Get(`/ablock/([^/]+)?`, readLockedArg(handleBlock))
+	server.Get(`/ecblock/([^/]+)?`, readLockedArg(handleBlock))
+	server.Get(`/fblock/([^/]+)?`, readLockedArg(handleBlock))
+	server.Get(`/entry/([^/]+)?`, readLockedArg(handleEntry))
+	server.Get(`/entry/([^/]+)?`, readLockedArg(handleEntry))
+	server.Get(`/tx/([^/]+)?`, readLockedArg(handleTransaction))
+	server.Get(`/address/([^/]+)?`, readLockedArg(handleAddressURL))
+	server.Get(`/admin/?`, readLocked(handleAdminHistory))
+	server.Get(`/anchors/?`, readLocked(handleAnchors))
+	server.Get(`/extid/(.+)`, readLockedArg(handleEntryEid))
+	server.Get(`/search/text/?`, readLocked(handleTextSearch))
+	server.Get(`/status/?`, readLocked(handleStatus))
+	server.Post(`/search/?`, readLocked(handleSearch))
 	server.Get(`/test`, test)
+	registerAPIRoutes()
 	server.Get(`/.*`, handle404)
 
 	go SynchronizationGoroutine()
@@ -88,21 +109,83 @@ func main() {
 	server.Run(fmt.Sprintf(":%d", cfg.PortNumber))
 }
 
+// readLocked and readLockedArg wrap a handler in ReadLock, so pages never
+// show what a synchronization batch has not committed yet.
+func readLocked(handler func(*web.Context)) func(*web.Context) {
+	return func(ctx *web.Context) {
+		ReadLock()
+		defer ReadUnlock()
+		handler(ctx)
+	}
+}
+
+func readLockedArg(handler func(*web.Context, string)) func(*web.Context, string) {
+	return func(ctx *web.Context, arg string) {
+		ReadLock()
+		defer ReadUnlock()
+		handler(ctx, arg)
+	}
+}
+
+const SyncInterval time.Duration = 10 * time.Second
+const MaxSyncBackoff time.Duration = 10 * time.Minute
+
+// SynchronizationGoroutine keeps the database in sync with the node. Errors
+// never stop the explorer - they are recorded in DataStatus and the pass is
+// retried with an exponential backoff, while the site keeps serving whatever
+// has already been synchronized.
 func SynchronizationGoroutine() {
+	backoff := SyncInterval
 	for {
-		err := Synchronize()
+		err := SynchronizationPass()
 		if err != nil {
-			panic(err)
+			log.Printf("Synchronization failed, retrying in %v - %v", backoff, err)
+			err = RecordSyncError(err)
+			if err != nil {
+				log.Printf("Error recording synchronization error - %v", err)
+			}
+			time.Sleep(backoff)
+			backoff = NextSyncBackoff(backoff)
+			continue
 		}
-		time.Sleep(10 * time.Second)
-		err = ProcessBlocks()
+		err = RecordSyncSuccess()
 		if err != nil {
-			panic(err)
+			log.Printf("Error recording synchronization success - %v", err)
 		}
-		time.Sleep(10 * time.Second)
+		backoff = SyncInterval
+		time.Sleep(SyncInterval)
 	}
 }
 
+// SynchronizationPass runs a single Synchronize and ProcessBlocks round,
+// turning any panic along the way into an error.
+func SynchronizationPass() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Synchronization panicked - %v", r)
+		}
+	}()
+
+	err = Synchronize()
+	if err != nil {
+		return err
+	}
+	time.Sleep(SyncInterval)
+	return ProcessBlocks()
+}
+
+func NextSyncBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > MaxSyncBackoff {
+		return MaxSyncBackoff
+	}
+	return next
+}
+
+func handleStatus(ctx *web.Context) {
+	tpl.ExecuteTemplate(ctx, "status.html", GetSyncStatus())
+}
+
 func test(ctx *web.Context) {
 	head, err := factom.GetChainHead("000000000000000000000000000000000000000000000000000000000000000a")
 	log.Printf("test - %v, %v", head.ChainHead, err)
@@ -141,28 +224,246 @@ func handleSearch(ctx *web.Context) {
 	case "block":
 		handleBlock(ctx, searchText)
 	case "dblock":
-		handleDBlock(ctx, searchText)
+		if _, err := strconv.Atoi(searchText); err == nil {
+			handleDBlockHeight(ctx, searchText)
+		} else {
+			handleDBlock(ctx, searchText)
+		}
 	case "address":
 		handleAddress(ctx, searchText)
-		/*	case "extID":
-			handleEntryEid(ctx, searchText)*/
+	case "", "auto":
+		handleAutoSearch(ctx, searchText)
+	case "text":
+		ctx.Redirect(302, "/search/text?"+url.Values{"q": {searchText}}.Encode())
+	case "extID":
+		//Search results are paginated, so they need a URL of their own
+		ctx.Redirect(302, "/extid/"+url.PathEscape(searchText))
 	default:
 		handle404(ctx)
 	}
 }
 
+// handleAutoSearch redirects to whatever the search text turned out to be,
+// lists the candidates when there are several and falls back to searching
+// entry text when there are none. Private keys are answered in place with a
+// warning, so they never end up in a URL.
+func handleAutoSearch(ctx *web.Context, searchText string) {
+	type searchPlus struct {
+		Query   string
+		Results []SearchResult
+	}
+
+	if IsPrivateKey(searchText) {
+		handleAddress(ctx, searchText)
+		return
+	}
+
+	results, err := Search(searchText)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+
+	switch len(results) {
+	case 0:
+		ctx.Redirect(302, "/search/text?"+url.Values{"q": {searchText}}.Encode())
+	case 1:
+		ctx.Redirect(302, results[0].URL)
+	default:
+		tpl.ExecuteTemplate(ctx, "search.html", searchPlus{Query: searchText, Results: results})
+	}
+}
+
+func handleTransaction(ctx *web.Context, txID string) {
+	tx, err := LoadTransaction(strings.ToLower(txID))
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+	if tx == nil {
+		handle404(ctx)
+		return
+	}
+
+	tpl.ExecuteTemplate(ctx, "tx.html", tx)
+}
+
+func handleAdminHistory(ctx *web.Context) {
+	type adminPlus struct {
+		Events   []*AdminEvent
+		Type     string
+		Types    []string
+		PageInfo *PageState
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			log.Println(err)
+			handle404(ctx)
+			return
+		}
+	}
+
+	eventType := ctx.Params["type"]
+	events, total, err := GetAdminHistory(eventType, 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+	pages := (total / 50) + 1
+	if page > pages {
+		handle404(ctx)
+		return
+	}
+
+	a := adminPlus{
+		Events: events,
+		Type:   eventType,
+		Types:  AdminEventTypes(),
+		PageInfo: &PageState{
+			Current: page,
+			Max:     pages,
+		},
+	}
+	if eventType != "" {
+		a.PageInfo.Query = template.URL("&type=" + url.QueryEscape(eventType))
+	}
+
+	tpl.ExecuteTemplate(ctx, "admin.html", a)
+}
+
+func handleAnchors(ctx *web.Context) {
+	type anchorsPlus struct {
+		Anchors        []*AnchorStatus
+		UnanchoredOnly bool
+		UnanchoredAge  int
+		PageInfo       *PageState
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			log.Println(err)
+			handle404(ctx)
+			return
+		}
+	}
+
+	unanchoredOnly := ctx.Params["unanchored"] == "true"
+	anchors, pages, err := GetAnchorStatuses(page, unanchoredOnly)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+	if page < 1 || page > pages {
+		handle404(ctx)
+		return
+	}
+
+	a := anchorsPlus{
+		Anchors:        anchors,
+		UnanchoredOnly: unanchoredOnly,
+		UnanchoredAge:  UnanchoredAge,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     pages,
+		},
+	}
+	if unanchoredOnly == true {
+		a.PageInfo.Query = "&unanchored=true"
+	}
+
+	tpl.ExecuteTemplate(ctx, "anchors.html", a)
+}
+
+// handleAddressURL serves addresses from their URL. Private keys never go in
+// a URL, they are only answered from the search form.
+func handleAddressURL(ctx *web.Context, hash string) {
+	if IsPrivateKey(hash) {
+		handle404(ctx)
+		return
+	}
+	handleAddress(ctx, hash)
+}
+
 func handleAddress(ctx *web.Context, hash string) {
-	address, err := GetAddressInformationFromFactom(hash)
+	type addressPlus struct {
+		*Address
+		Height       string
+		IsPrivateKey bool
+		Transactions []*AddressTransaction
+		PageInfo     *PageState
+	}
+
+	var err error
+	height := -1
+	if h := ctx.Params["height"]; h != "" {
+		height, err = strconv.Atoi(h)
+		if err != nil || height < 0 {
+			log.Println(err)
+			handle404(ctx)
+			return
+		}
+	}
+
+	address, err := GetAddressInformation(hash, height)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			log.Println(err)
+			handle404(ctx)
+			return
+		}
+	}
+
+	history, total, err := GetAddressHistory(hash, 50*(page-1), 50)
 	if err != nil {
 		log.Println(err)
 		handle404(ctx)
 		return
 	}
 
-	tpl.ExecuteTemplate(ctx, "address.html", address)
+	a := addressPlus{
+		Address:      address,
+		Height:       ctx.Params["height"],
+		IsPrivateKey: IsPrivateKeyType(address.AddressType),
+		Transactions: history,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     (total / 50) + 1,
+		},
+	}
+	if page > a.PageInfo.Max {
+		handle404(ctx)
+		return
+	}
+
+	tpl.ExecuteTemplate(ctx, "address.html", a)
 }
 
 func handleChain(ctx *web.Context, hash string) {
+	type chainPlus struct {
+		Chain    *Chain
+		Blocks   []*Block
+		PageInfo *PageState
+	}
+
 	chain, err := GetChainByName(hash)
 	if err != nil {
 		log.Println(err)
@@ -170,40 +471,140 @@ func handleChain(ctx *web.Context, hash string) {
 		return
 	}
 
-	tpl.ExecuteTemplate(ctx, "chain.html", chain)
+	c := chainPlus{
+		Chain: chain,
+		PageInfo: &PageState{
+			Current: 1,
+			Max:     (chain.EntryCount / 50) + 1,
+		},
+	}
+
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			log.Println(err)
+			handle404(ctx)
+			return
+		}
+		c.PageInfo.Current = page
+	}
+	if page > c.PageInfo.Max {
+		handle404(ctx)
+		return
+	}
+	c.Blocks, err = GetChainHistory(chain, 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+
+	tpl.ExecuteTemplate(ctx, "chain.html", c)
 }
 
 func handleChains(ctx *web.Context) {
-	chains, err := GetChains()
+	handleChainsSorted(ctx, ChainSortCreated)
+}
+
+func handleChainsSorted(ctx *web.Context, sortBy string) {
+	type chainsPlus struct {
+		Chains   []*Chain
+		Sort     string
+		PageInfo *PageState
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			log.Println(err)
+			handle404(ctx)
+			return
+		}
+	}
+
+	chains, total, err := GetChains(sortBy, 50*(page-1), 50)
 	if err != nil {
 		log.Println(err)
 		handle404(ctx)
 		return
 	}
 
-	tpl.ExecuteTemplate(ctx, "chains.html", chains)
+	c := chainsPlus{
+		Chains: chains,
+		Sort:   sortBy,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     (total / 50) + 1,
+		},
+	}
+	if page > c.PageInfo.Max {
+		handle404(ctx)
+		return
+	}
+
+	tpl.ExecuteTemplate(ctx, "chains.html", c)
 }
 
 func handleDBlock(ctx *web.Context, keyMR string) {
+	dblock, err := GetDBlock(keyMR)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+	renderDBlock(ctx, dblock)
+}
+
+func handleDBlockHeight(ctx *web.Context, height string) {
+	h, err := strconv.Atoi(height)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+	dblock, err := LoadDBlockBySequence(h)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+	renderDBlock(ctx, dblock)
+}
+
+func renderDBlock(ctx *web.Context, dblock *DBlock) {
 	type fullblock struct {
 		DBlock *DBlock
 		DBInfo DBInfo
+
+		//Heights of the neighbouring DBlocks, -1 if we do not have them
+		PrevHeight int
+		NextHeight int
 	}
 
-	dblock, err := GetDBlock(keyMR)
-	if err != nil {
-		log.Println(err)
+	if dblock == nil {
 		handle404(ctx)
 		return
 	}
-	dbinfo, err := GetDBInfo(keyMR)
+	dbinfo, err := GetDBInfo(dblock.KeyMR)
 	if err != nil {
 		log.Println(err)
 	}
 
 	b := fullblock{
-		DBlock: dblock,
-		DBInfo: dbinfo,
+		DBlock:     dblock,
+		DBInfo:     dbinfo,
+		PrevHeight: dblock.SequenceNumber - 1,
+		NextHeight: -1,
+	}
+	next, err := LoadDBlockKeyMRBySequence(dblock.SequenceNumber + 1)
+	if err != nil {
+		log.Println(err)
+	}
+	if next != "" {
+		b.NextHeight = dblock.SequenceNumber + 1
 	}
 
 	tpl.ExecuteTemplate(ctx, "dblock.html", b)
@@ -234,7 +635,7 @@ func handleDBlocks(ctx *web.Context) {
 	page := 1
 	if p := ctx.Params["page"]; p != "" {
 		page, err = strconv.Atoi(p)
-		if err != nil {
+		if err != nil || page < 1 {
 			log.Println(err)
 			handle404(ctx)
 			return
@@ -271,6 +672,10 @@ func handleBlock(ctx *web.Context, mr string) {
 		return
 	}
 
+	//Work on a copy so paginating doesn't trim the cached block
+	blockCopy := *block
+	block = &blockCopy
+
 	e := blockPlus{
 		Block: block,
 		Hash:  mr,
@@ -284,7 +689,7 @@ func handleBlock(ctx *web.Context, mr string) {
 	page := 1
 	if p := ctx.Params["page"]; p != "" {
 		page, err = strconv.Atoi(p)
-		if err != nil {
+		if err != nil || page < 1 {
 			log.Printf("handleEBlock - strconv\n")
 			log.Println(err)
 			handle404(ctx)
@@ -307,27 +712,166 @@ func handleBlock(ctx *web.Context, mr string) {
 }
 
 func handleEntry(ctx *web.Context, hash string) {
+	type entryPlus struct {
+		*Entry
+		Commit *Entry
+	}
+
 	entry, err := GetEntry(hash)
 	if err != nil {
 		log.Println(err)
 		handle404(ctx)
 		return
 	}
+	if entry == nil {
+		handle404(ctx)
+		return
+	}
 
-	tpl.ExecuteTemplate(ctx, "entry.html", entry)
+	e := entryPlus{Entry: entry}
+	e.Commit, err = GetEntryCommit(entry.Hash)
+	if err != nil {
+		log.Println(err)
+	}
+
+	tpl.ExecuteTemplate(ctx, "entry.html", e)
 }
 
-/*
 func handleEntryEid(ctx *web.Context, eid string) {
-	entries, err := factom.GetEntriesByExtID(eid)
+	type entriesPlus struct {
+		ExtID    string
+		Entries  []*Entry
+		PageInfo *PageState
+	}
+
+	var err error
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			log.Println(err)
+			handle404(ctx)
+			return
+		}
+	}
+
+	entries, total, err := GetEntriesByExtID(eid, 50*(page-1), 50)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+
+	e := entriesPlus{
+		ExtID:   eid,
+		Entries: entries,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     (total / 50) + 1,
+		},
+	}
+	if total == 0 || page > e.PageInfo.Max {
+		handle404(ctx)
+		return
+	}
+
+	tpl.ExecuteTemplate(ctx, "entries.html", e)
+}
+
+// textQueryFromParams reads a full-text search from the q, chain, from and to
+// request parameters.
+func textQueryFromParams(params map[string]string) (*TextQuery, error) {
+	q := new(TextQuery)
+	q.Phrases = ParseTextQuery(params["q"])
+	if len(q.Phrases) == 0 {
+		return nil, errors.New("Empty search query")
+	}
+	q.ChainID = strings.ToLower(params["chain"])
+	q.FromHeight = -1
+	q.ToHeight = -1
+
+	var err error
+	if from := params["from"]; from != "" {
+		q.FromHeight, err = strconv.Atoi(from)
+		if err != nil || q.FromHeight < 0 {
+			return nil, errors.New("Invalid from height")
+		}
+	}
+	if to := params["to"]; to != "" {
+		q.ToHeight, err = strconv.Atoi(to)
+		if err != nil || q.ToHeight < 0 {
+			return nil, errors.New("Invalid to height")
+		}
+	}
+	return q, nil
+}
+
+// textQueryParams encodes the search parameters for pagination links.
+func textQueryParams(params map[string]string) template.URL {
+	v := url.Values{}
+	for _, key := range []string{"q", "chain", "from", "to"} {
+		if params[key] != "" {
+			v.Set(key, params[key])
+		}
+	}
+	return template.URL("&" + v.Encode())
+}
+
+func handleTextSearch(ctx *web.Context) {
+	type searchPlus struct {
+		Query    string
+		ChainID  string
+		From     string
+		To       string
+		Entries  []*Entry
+		Total    int
+		PageInfo *PageState
+	}
+
+	q, err := textQueryFromParams(ctx.Params)
+	if err != nil {
+		log.Println(err)
+		handle404(ctx)
+		return
+	}
+
+	page := 1
+	if p := ctx.Params["page"]; p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			log.Println(err)
+			handle404(ctx)
+			return
+		}
+	}
+
+	entries, total, err := SearchText(q, 50*(page-1), 50)
 	if err != nil {
 		log.Println(err)
 		handle404(ctx)
 		return
 	}
 
-	tpl.ExecuteTemplate(ctx, "entries.html", entries)
-}*/
+	s := searchPlus{
+		Query:   ctx.Params["q"],
+		ChainID: ctx.Params["chain"],
+		From:    ctx.Params["from"],
+		To:      ctx.Params["to"],
+		Entries: entries,
+		Total:   total,
+		PageInfo: &PageState{
+			Current: page,
+			Max:     (total / 50) + 1,
+			Query:   textQueryParams(ctx.Params),
+		},
+	}
+	if page > s.PageInfo.Max {
+		handle404(ctx)
+		return
+	}
+
+	tpl.ExecuteTemplate(ctx, "textsearch.html", s)
+}
 
 func handleHome(ctx *web.Context) {
 	handleDBlocks(ctx)
@@ -336,6 +880,9 @@ func handleHome(ctx *web.Context) {
 type PageState struct {
 	Current int
 	Max     int
+
+	//Extra query parameters for pages with their own, starting with "&"
+	Query template.URL `json:",omitempty"`
 }
 
 func (p *PageState) Next() int {
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextSyncBackoff(t *testing.T) {
+	backoff := SyncInterval
+	for i := 0; i < 20; i++ {
+		next := NextSyncBackoff(backoff)
+		if next < backoff {
+			t.Errorf("Backoff decreased from %v to %v", backoff, next)
+		}
+		if next > MaxSyncBackoff {
+			t.Errorf("Backoff %v exceeds the maximum of %v", next, MaxSyncBackoff)
+		}
+		backoff = next
+	}
+	if backoff != MaxSyncBackoff {
+		t.Errorf("Backoff should settle at %v, got %v", MaxSyncBackoff, backoff)
+	}
+	if NextSyncBackoff(10*time.Second) != 20*time.Second {
+		t.Errorf("Backoff should double")
+	}
+}
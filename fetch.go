@@ -0,0 +1,91 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// FetchPool runs fetches on a fixed set of long-lived workers and bounds how
+// many requests are made to the node at the same time. Run hands its work to
+// the idle workers and works through it itself as well, so nested fan outs
+// (entry blocks, then their entries) always make progress and never start
+// more goroutines than there are workers.
+type FetchPool struct {
+	jobs  chan func()
+	slots chan struct{}
+}
+
+var Fetcher = NewFetchPool(cfg.FetchWorkers)
+
+func NewFetchPool(workers int) *FetchPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := new(FetchPool)
+	p.jobs = make(chan func())
+	p.slots = make(chan struct{}, workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *FetchPool) work() {
+	for job := range p.jobs {
+		job()
+	}
+}
+
+func (p *FetchPool) GetRaw(hash string) ([]byte, error) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+	return Node.GetRaw(hash)
+}
+
+// Run calls f for every index from 0 to n-1 on the caller and the idle
+// workers, waits for all of them to finish and returns the first error
+// encountered.
+func (p *FetchPool) Run(n int, f func(i int) error) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	var next int64 = -1
+
+	//Every runner takes the next index until there are none left
+	run := func() {
+		defer wg.Done()
+		for {
+			i := int(atomic.AddInt64(&next, 1))
+			if i >= n {
+				return
+			}
+			err := f(i)
+			if err != nil {
+				once.Do(func() { firstErr = err })
+			}
+		}
+	}
+
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		handed := false
+		select {
+		case p.jobs <- run:
+			handed = true
+		default:
+		}
+		if handed == false {
+			wg.Done()
+			break
+		}
+	}
+	wg.Add(1)
+	run()
+	wg.Wait()
+
+	return firstErr
+}
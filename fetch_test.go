@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type countingClient struct {
+	FixtureClient
+
+	mutex   sync.Mutex
+	current int
+	max     int
+}
+
+func (c *countingClient) GetRaw(hash string) ([]byte, error) {
+	c.mutex.Lock()
+	c.current++
+	if c.current > c.max {
+		c.max = c.current
+	}
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.current--
+		c.mutex.Unlock()
+	}()
+	return []byte(hash), nil
+}
+
+func TestFetchPoolBoundsRequests(t *testing.T) {
+	client := new(countingClient)
+	resetTestData(client)
+
+	pool := NewFetchPool(3)
+	results := make([]string, 50)
+	err := pool.Run(len(results), func(i int) error {
+		raw, err := pool.GetRaw(fmt.Sprintf("%v", i))
+		if err != nil {
+			return err
+		}
+		results[i] = string(raw)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range results {
+		if v != fmt.Sprintf("%v", i) {
+			t.Errorf("Result %v is %v", i, v)
+		}
+	}
+	if client.max > 3 {
+		t.Errorf("%v requests ran at the same time, expected at most 3", client.max)
+	}
+}
+
+func TestFetchPoolReturnsError(t *testing.T) {
+	pool := NewFetchPool(2)
+	err := pool.Run(10, func(i int) error {
+		if i == 7 {
+			return fmt.Errorf("Failed %v", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "Failed 7" {
+		t.Errorf("Expected error from the failing call, got %v", err)
+	}
+}
+
+func TestFetchPoolNestedRun(t *testing.T) {
+	pool := NewFetchPool(2)
+	var mutex sync.Mutex
+	done := 0
+	err := pool.Run(20, func(i int) error {
+		return pool.Run(20, func(j int) error {
+			mutex.Lock()
+			done++
+			mutex.Unlock()
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done != 400 {
+		t.Errorf("%v nested calls ran, expected 400", done)
+	}
+}
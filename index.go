@@ -0,0 +1,381 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ExternalIDKeys returns the keys an entry is indexed under - every external
+// ID both hex encoded and decoded.
+func ExternalIDKeys(e *Entry) []string {
+	answer := []string{}
+	seen := map[string]bool{}
+	for _, v := range e.ExternalIDs {
+		for _, key := range []string{v.Encoded, v.Decoded} {
+			if key == "" || seen[key] == true {
+				continue
+			}
+			seen[key] = true
+			answer = append(answer, key)
+		}
+	}
+	return answer
+}
+
+// extIDPrefix starts the index keys of an external ID. External IDs can hold
+// anything, the separator included, so they are hex encoded.
+func extIDPrefix(extID string) string {
+	return fmt.Sprintf("%x|", extID)
+}
+
+// extIDPostingKey is the index key of an entry using an external ID. Keys sort
+// oldest first by the height of the DBlock the entry was included in.
+func extIDPostingKey(extID string, height int, hash string) string {
+	return fmt.Sprintf("%v%016x|%v", extIDPrefix(extID), uint64(height), hash)
+}
+
+// IndexBlockExternalIDs adds the entries of an entry block to the external
+// ID index, one key per external ID and entry.
+func IndexBlockExternalIDs(b *Block) error {
+	for _, e := range b.EntryList {
+		for _, key := range ExternalIDKeys(e) {
+			err := SaveIndexKey(ExtIDIndexesBucket, extIDPostingKey(key, b.DBlockHeight, e.Hash), e.Hash)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnindexBlockExternalIDs removes the entries of an entry block from the
+// external ID index.
+func UnindexBlockExternalIDs(b *Block) error {
+	for _, e := range b.EntryList {
+		for _, key := range ExternalIDKeys(e) {
+			err := DeleteIndexKey(ExtIDIndexesBucket, extIDPostingKey(key, b.DBlockHeight, e.Hash))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadEntryHashesByExtID returns up to max of the hashes of the entries using
+// an external ID, oldest first, skipping the first start of them, along with
+// the total number of entries using it.
+func LoadEntryHashesByExtID(extID string, start, max int) ([]string, int, error) {
+	keys, _, total, err := LoadIndexKeys(ExtIDIndexesBucket, extIDPrefix(extID), start, max, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	hashes := []string{}
+	for _, v := range keys {
+		hashes = append(hashes, v[strings.LastIndex(v, "|")+1:])
+	}
+	return hashes, total, nil
+}
+
+// GetEntriesByExtID returns up to max of the entries using an external ID,
+// skipping the first start of them, along with the total number of matches.
+func GetEntriesByExtID(extID string, start, max int) ([]*Entry, int, error) {
+	hashes, total, err := LoadEntryHashesByExtID(extID, start, max)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	answer := []*Entry{}
+	for _, v := range hashes {
+		entry, err := LoadEntry(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		if entry == nil {
+			continue
+		}
+		answer = append(answer, entry)
+	}
+	return answer, total, nil
+}
+
+// TextPosting records an entry containing a word, along with what search
+// results are filtered on so entries do not need to be loaded for it.
+type TextPosting struct {
+	Hash    string
+	ChainID string
+	Height  int
+}
+
+// TextQuery is a parsed full-text search. An entry matches when every phrase
+// appears in its content or in one of its external IDs.
+type TextQuery struct {
+	Phrases [][]string
+
+	//Empty to search every chain
+	ChainID string
+	//Negative to leave the range open on that side
+	FromHeight int
+	ToHeight   int
+}
+
+// MaxIndexedWordLength skips longer words, which are most likely hashes or
+// binary data and not worth indexing.
+const MaxIndexedWordLength int = 64
+
+// Tokenize splits text into lowercase words made of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsLetter(r) == false && unicode.IsDigit(r) == false
+	})
+}
+
+// entryTextFields returns the decoded content and external IDs of an entry,
+// tokenized separately so phrases cannot span two fields.
+func entryTextFields(e *Entry) [][]string {
+	answer := [][]string{}
+	if e.Content != nil {
+		answer = append(answer, Tokenize(e.Content.Decoded))
+	}
+	for _, v := range e.ExternalIDs {
+		answer = append(answer, Tokenize(v.Decoded))
+	}
+	return answer
+}
+
+func entryWords(e *Entry) []string {
+	answer := []string{}
+	seen := map[string]bool{}
+	for _, field := range entryTextFields(e) {
+		for _, word := range field {
+			if len(word) > MaxIndexedWordLength || seen[word] == true {
+				continue
+			}
+			seen[word] = true
+			answer = append(answer, word)
+		}
+	}
+	return answer
+}
+
+// textPostingKey is the index key of an entry containing a word. Keys sort
+// oldest first by the height of the DBlock the entry was included in.
+func textPostingKey(word string, height int, hash string) string {
+	return fmt.Sprintf("%v|%016x|%v", word, uint64(height), hash)
+}
+
+// IndexBlockText adds the entries of an entry block to the text index, one
+// key per word and entry.
+func IndexBlockText(b *Block) error {
+	for _, e := range b.EntryList {
+		posting := TextPosting{Hash: e.Hash, ChainID: b.ChainID, Height: b.DBlockHeight}
+		for _, word := range entryWords(e) {
+			err := SaveIndexKey(TextIndexesBucket, textPostingKey(word, b.DBlockHeight, e.Hash), posting)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnindexBlockText removes the entries of an entry block from the text index.
+func UnindexBlockText(b *Block) error {
+	for _, e := range b.EntryList {
+		for _, word := range entryWords(e) {
+			err := DeleteIndexKey(TextIndexesBucket, textPostingKey(word, b.DBlockHeight, e.Hash))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadTextPostings returns up to max of the entries containing a word, oldest
+// first, skipping the first start of them, along with the total number of
+// entries containing it.
+func LoadTextPostings(word string, start, max int) ([]TextPosting, int, error) {
+	keys, values, total, err := LoadIndexKeys(TextIndexesBucket, word+"|", start, max, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	answer := []TextPosting{}
+	for i, v := range values {
+		posting := new(TextPosting)
+		_, err = DecodeIndexValue(TextIndexesBucket, keys[i], v, posting)
+		if err != nil {
+			return nil, 0, err
+		}
+		answer = append(answer, *posting)
+	}
+	return answer, total, nil
+}
+
+// hasTextPosting reports whether an entry is indexed under a word.
+func hasTextPosting(word string, p TextPosting) (bool, error) {
+	posting, err := LoadIndexKey(TextIndexesBucket, textPostingKey(word, p.Height, p.Hash), new(TextPosting))
+	if err != nil {
+		return false, err
+	}
+	return posting != nil, nil
+}
+
+// ParseTextQuery splits a query into phrases. Text in double quotes is a
+// single phrase, every other word is a phrase of its own.
+func ParseTextQuery(query string) [][]string {
+	answer := [][]string{}
+	for i, part := range strings.Split(query, "\"") {
+		words := Tokenize(part)
+		if len(words) == 0 {
+			continue
+		}
+		//Odd parts are the ones between quotes
+		if i%2 == 1 {
+			answer = append(answer, words)
+			continue
+		}
+		for _, v := range words {
+			answer = append(answer, []string{v})
+		}
+	}
+	return answer
+}
+
+func containsPhrase(field, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(field); i++ {
+		match := true
+		for j, v := range phrase {
+			if field[i+j] != v {
+				match = false
+				break
+			}
+		}
+		if match == true {
+			return true
+		}
+	}
+	return false
+}
+
+// EntryMatchesPhrases reports whether every phrase appears in the content or
+// one of the external IDs of an entry.
+func EntryMatchesPhrases(e *Entry, phrases [][]string) bool {
+	fields := entryTextFields(e)
+	for _, phrase := range phrases {
+		found := false
+		for _, field := range fields {
+			if containsPhrase(field, phrase) {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *TextQuery) matchesPosting(p TextPosting) bool {
+	if q.ChainID != "" && q.ChainID != p.ChainID {
+		return false
+	}
+	if q.FromHeight >= 0 && p.Height < q.FromHeight {
+		return false
+	}
+	if q.ToHeight >= 0 && p.Height > q.ToHeight {
+		return false
+	}
+	return true
+}
+
+// SearchText returns up to max of the entries matching a query, skipping the
+// first start of them, along with the total number of matches. Entries are
+// returned oldest first.
+func SearchText(q *TextQuery, start, max int) ([]*Entry, int, error) {
+	if len(q.Phrases) == 0 {
+		return nil, 0, errors.New("Empty search query")
+	}
+
+	//Candidates are the postings of the rarest word of the query, the other
+	//words are looked up for each of them
+	words := []string{}
+	rarest, rarestTotal := -1, 0
+	for _, phrase := range q.Phrases {
+		for _, word := range phrase {
+			_, total, err := LoadTextPostings(word, 0, 0)
+			if err != nil {
+				return nil, 0, err
+			}
+			if rarest < 0 || total < rarestTotal {
+				rarest, rarestTotal = len(words), total
+			}
+			words = append(words, word)
+		}
+	}
+	postings, _, err := LoadTextPostings(words[rarest], 0, -1)
+	if err != nil {
+		return nil, 0, err
+	}
+	candidates := []TextPosting{}
+	for _, v := range postings {
+		if q.matchesPosting(v) == false {
+			continue
+		}
+		matches := true
+		for i, word := range words {
+			if i == rarest {
+				continue
+			}
+			matches, err = hasTextPosting(word, v)
+			if err != nil {
+				return nil, 0, err
+			}
+			if matches == false {
+				break
+			}
+		}
+		if matches == true {
+			candidates = append(candidates, v)
+		}
+	}
+
+	needsVerification := false
+	for _, phrase := range q.Phrases {
+		if len(phrase) > 1 {
+			needsVerification = true
+		}
+	}
+
+	answer := []*Entry{}
+	total := 0
+	for _, v := range candidates {
+		inPage := total >= start && total < start+max
+		if needsVerification == false && inPage == false {
+			total++
+			continue
+		}
+		entry, err := LoadEntry(v.Hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		if entry == nil {
+			continue
+		}
+		if needsVerification == true && EntryMatchesPhrases(entry, q.Phrases) == false {
+			continue
+		}
+		if inPage == true {
+			answer = append(answer, entry)
+		}
+		total++
+	}
+	return answer, total, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testEntryWithExtIDs(hash string, extIDs ...string) *Entry {
+	e := new(Entry)
+	e.Hash = hash
+	e.ChainID = "c"
+	for _, v := range extIDs {
+		e.ExternalIDs = append(e.ExternalIDs, ByteSliceToDecodedString([]byte(v)))
+	}
+	return e
+}
+
+func TestExternalIDIndex(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	block := new(Block)
+	block.PartialHash = "b1"
+	block.FullHash = "f1"
+	block.IsEntryBlock = true
+	block.EntryList = []*Entry{
+		testEntryWithExtIDs("e1", "alpha", "beta"),
+		testEntryWithExtIDs("e2", "alpha"),
+		//External IDs can contain the key separator
+		testEntryWithExtIDs("e3", "alpha|0"),
+	}
+	err := IndexBlockExternalIDs(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Indexing a block twice must not duplicate its entries
+	err = IndexBlockExternalIDs(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, total, err := GetEntriesByExtID("alpha", 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(entries) != 2 || entries[0].Hash != "e1" || entries[1].Hash != "e2" {
+		t.Errorf("Wrong entries for alpha - %v, %v", total, entries)
+	}
+	entries, total, err = GetEntriesByExtID("62657461", 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(entries) != 1 || entries[0].Hash != "e1" {
+		t.Errorf("Wrong entries for hex encoded beta - %v, %v", total, entries)
+	}
+	entries, total, err = GetEntriesByExtID("alpha", 1, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(entries) != 1 || entries[0].Hash != "e2" {
+		t.Errorf("Wrong second page for alpha - %v, %v", total, entries)
+	}
+
+	err = DeleteBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes, total, err := LoadEntryHashesByExtID("alpha", 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 0 || total != 0 {
+		t.Errorf("Deleted entries still indexed - %v", hashes)
+	}
+}
+
+func TestParseTextQuery(t *testing.T) {
+	phrases := ParseTextQuery(`Hello "Big  World" again`)
+	if len(phrases) != 3 || len(phrases[0]) != 1 || phrases[0][0] != "hello" || len(phrases[1]) != 2 || phrases[1][1] != "world" || phrases[2][0] != "again" {
+		t.Errorf("Wrong phrases - %v", phrases)
+	}
+}
+
+func saveTestTextBlock(t *testing.T, keyMR, chainID string, height int, entries ...*Entry) *Block {
+	block := new(Block)
+	block.PartialHash = keyMR
+	block.FullHash = "f" + keyMR
+	block.ChainID = chainID
+	block.DBlockHeight = height
+	block.IsEntryBlock = true
+	for _, v := range entries {
+		v.ChainID = chainID
+	}
+	block.EntryList = entries
+	err := SaveBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = IndexBlockText(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestSearchText(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	testSearchText(t)
+}
+
+func TestSearchTextDatabase(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	defer initTestDatabase(t)()
+	testSearchText(t)
+}
+
+func testSearchText(t *testing.T) {
+	content := func(hash, text string, extIDs ...string) *Entry {
+		e := testEntryWithExtIDs(hash, extIDs...)
+		e.Content = ByteSliceToDecodedStringPointer([]byte(text))
+		return e
+	}
+	saveTestTextBlock(t, "b1", "c1", 1, content("e1", "The quick brown fox", "Animals"), content("e2", "brown the quick"))
+	block := saveTestTextBlock(t, "b2", "c2", 5, content("e3", "QUICK, brown fox!"))
+
+	search := func(q *TextQuery) string {
+		entries, total, err := SearchText(q, 0, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer := fmt.Sprintf("%v:", total)
+		for _, v := range entries {
+			answer += v.Hash
+		}
+		return answer
+	}
+
+	if s := search(&TextQuery{Phrases: ParseTextQuery("quick Brown"), FromHeight: -1, ToHeight: -1}); s != "3:e1e2e3" {
+		t.Errorf("Wrong results for words - %v", s)
+	}
+	if s := search(&TextQuery{Phrases: ParseTextQuery(`"quick brown"`), FromHeight: -1, ToHeight: -1}); s != "2:e1e3" {
+		t.Errorf("Wrong results for phrase - %v", s)
+	}
+	if s := search(&TextQuery{Phrases: ParseTextQuery("animals fox"), FromHeight: -1, ToHeight: -1}); s != "1:e1" {
+		t.Errorf("Wrong results for external ID - %v", s)
+	}
+	if s := search(&TextQuery{Phrases: ParseTextQuery("fox"), ChainID: "c2", FromHeight: -1, ToHeight: -1}); s != "1:e3" {
+		t.Errorf("Wrong results for chain filter - %v", s)
+	}
+	if s := search(&TextQuery{Phrases: ParseTextQuery("quick"), FromHeight: 2, ToHeight: -1}); s != "1:e3" {
+		t.Errorf("Wrong results for height filter - %v", s)
+	}
+	if s := search(&TextQuery{Phrases: ParseTextQuery("quick"), FromHeight: -1, ToHeight: 4}); s != "2:e1e2" {
+		t.Errorf("Wrong results for height filter - %v", s)
+	}
+
+	err := DeleteBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := search(&TextQuery{Phrases: ParseTextQuery("fox"), FromHeight: -1, ToHeight: -1}); s != "1:e1" {
+		t.Errorf("Deleted entries still found - %v", s)
+	}
+}
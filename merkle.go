@@ -0,0 +1,343 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// EBlockHeaderSize and DBlockHeaderSize are the sizes of the binary headers of
+// entry blocks and DBlocks.
+const EBlockHeaderSize int = 32 + 32 + 32 + 32 + 4 + 4 + 4
+const DBlockHeaderSize int = 1 + 4 + 32 + 32 + 32 + 4 + 4 + 4
+
+// MerkleStep is one level of a Merkle branch - the hash the running hash is
+// paired with.
+type MerkleStep struct {
+	Hash string
+	Left bool //whether Hash goes on the left of the running hash
+}
+
+// MerkleBranch proves that Leaf is part of the body of a block. The block's
+// KeyMR is the hash of its HeaderHash followed by the Merkle root of its body.
+type MerkleBranch struct {
+	Leaf       string
+	Steps      []MerkleStep
+	HeaderHash string
+	KeyMR      string
+}
+
+// EntryProof proves that an entry is part of an entry block, which is part of
+// a DBlock, which is anchored into Bitcoin. Everything is hex encoded.
+type EntryProof struct {
+	EntryHash string
+	EntryData string
+	ChainID   string
+
+	//From the entry hash to the entry block KeyMR
+	EntryBlock MerkleBranch
+	//From the entry block to the DBlock KeyMR
+	DBlock       MerkleBranch
+	DBlockHeight int
+
+	//Nil if the DBlock is not anchored yet
+	Anchor *AnchorProof
+}
+
+// AnchorProof is the signed anchor record of a DBlock.
+type AnchorProof struct {
+	AnchorEntry  string
+	AnchorRecord string //the anchor chain entry content, JSON followed by its signature
+	TXID         string
+	BlockHash    string
+	BlockHeight  int32
+}
+
+func sha256Sum(data ...[]byte) []byte {
+	h := sha256.Sum256(bytes.Join(data, nil))
+	return h[:]
+}
+
+// ComputeEntryHash returns the hash of a marshalled entry.
+func ComputeEntryHash(data []byte) []byte {
+	h := sha512.Sum512(data)
+	return sha256Sum(h[:], data)
+}
+
+// ComputeMerkleRoot returns the root of the Merkle tree of the leaves along
+// with the branch from the leaf at index to it. An odd node out is paired with
+// itself.
+func ComputeMerkleRoot(leaves [][]byte, index int) ([]byte, []MerkleStep) {
+	if len(leaves) == 0 {
+		return make([]byte, 32), nil
+	}
+	steps := []MerkleStep{}
+	level := leaves
+	for len(level) > 1 {
+		next := [][]byte{}
+		for i := 0; i < len(level); i += 2 {
+			left, right := level[i], level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			if index == i {
+				steps = append(steps, MerkleStep{Hash: fmt.Sprintf("%x", right), Left: false})
+			} else if index == i+1 {
+				steps = append(steps, MerkleStep{Hash: fmt.Sprintf("%x", left), Left: true})
+			}
+			next = append(next, sha256Sum(left, right))
+		}
+		index = index / 2
+		level = next
+	}
+	return level[0], steps
+}
+
+// SplitEBlock splits a marshalled entry block into its header and the
+// hashes of its body.
+func SplitEBlock(raw []byte) ([]byte, [][]byte, error) {
+	return splitBlock(raw, EBlockHeaderSize, 32)
+}
+
+// SplitDBlock splits a marshalled DBlock into its header and the hashes of
+// the ChainID and KeyMR pairs of its body.
+func SplitDBlock(raw []byte) ([]byte, [][]byte, error) {
+	header, body, err := splitBlock(raw, DBlockHeaderSize, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range body {
+		body[i] = sha256Sum(body[i])
+	}
+	return header, body, nil
+}
+
+func splitBlock(raw []byte, headerSize, entrySize int) ([]byte, [][]byte, error) {
+	if len(raw) < headerSize || (len(raw)-headerSize)%entrySize != 0 {
+		return nil, nil, fmt.Errorf("Invalid block length %v", len(raw))
+	}
+	body := [][]byte{}
+	for i := headerSize; i < len(raw); i += entrySize {
+		body = append(body, raw[i:i+entrySize])
+	}
+	return raw[:headerSize], body, nil
+}
+
+func buildMerkleBranch(header []byte, leaves [][]byte, leaf []byte) (*MerkleBranch, error) {
+	index := -1
+	for i, v := range leaves {
+		if bytes.Equal(v, leaf) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("%x is not part of the block", leaf)
+	}
+	bodyMR, steps := ComputeMerkleRoot(leaves, index)
+	headerHash := sha256Sum(header)
+
+	answer := new(MerkleBranch)
+	answer.Leaf = fmt.Sprintf("%x", leaf)
+	answer.Steps = steps
+	answer.HeaderHash = fmt.Sprintf("%x", headerHash)
+	answer.KeyMR = fmt.Sprintf("%x", sha256Sum(headerHash, bodyMR))
+	return answer, nil
+}
+
+// ErrRawDBlockNotStored is returned by BuildEntryProof for the DBlocks stored
+// before their marshalled form was kept. The database check refetches them.
+var ErrRawDBlockNotStored error = errors.New("Marshalled DBlock is not stored")
+
+// BuildEntryProof returns the proof that an entry is part of the blockchain,
+// or nil if we do not have the entry. Nothing is fetched from the node, as
+// proofs are built while holding the database read lock.
+func BuildEntryProof(entryHash string) (*EntryProof, error) {
+	entry, err := LoadEntry(entryHash)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	if entry.EntryBlock == "" {
+		return nil, fmt.Errorf("Entry block of entry %v is not known", entryHash)
+	}
+
+	answer := new(EntryProof)
+	answer.EntryHash = entry.Hash
+	answer.EntryData = entry.BinaryString
+	answer.ChainID = entry.ChainID
+
+	block, err := LoadBlock(entry.EntryBlock)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("Entry block %v not found", entry.EntryBlock)
+	}
+	raw, err := hex.DecodeString(block.BinaryString)
+	if err != nil {
+		return nil, err
+	}
+	header, leaves, err := SplitEBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := hex.DecodeString(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	branch, err := buildMerkleBranch(header, leaves, leaf)
+	if err != nil {
+		return nil, err
+	}
+	if branch.KeyMR != block.PartialHash {
+		return nil, fmt.Errorf("Computed KeyMR %v does not match entry block %v", branch.KeyMR, block.PartialHash)
+	}
+	answer.EntryBlock = *branch
+
+	dBlock, err := LoadDBlockBySequence(block.DBlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	if dBlock == nil {
+		return nil, fmt.Errorf("DBlock %v not found", block.DBlockHeight)
+	}
+	if dBlock.BinaryString == "" {
+		return nil, ErrRawDBlockNotStored
+	}
+	raw, err = hex.DecodeString(dBlock.BinaryString)
+	if err != nil {
+		return nil, err
+	}
+	header, leaves, err = SplitDBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := hex.DecodeString(block.ChainID + block.PartialHash)
+	if err != nil {
+		return nil, err
+	}
+	branch, err = buildMerkleBranch(header, leaves, sha256Sum(pair))
+	if err != nil {
+		return nil, err
+	}
+	if branch.KeyMR != dBlock.KeyMR {
+		return nil, fmt.Errorf("Computed KeyMR %v does not match DBlock %v", branch.KeyMR, dBlock.KeyMR)
+	}
+	answer.DBlock = *branch
+	answer.DBlockHeight = dBlock.SequenceNumber
+
+	if dBlock.AnchorRecord == "" {
+		return answer, nil
+	}
+	anchor, err := LoadEntry(dBlock.AnchorRecord)
+	if err != nil {
+		return nil, err
+	}
+	if anchor == nil || anchor.AnchorRecord == nil || anchor.Content == nil {
+		return answer, nil
+	}
+	answer.Anchor = new(AnchorProof)
+	answer.Anchor.AnchorEntry = anchor.Hash
+	answer.Anchor.AnchorRecord = anchor.Content.Decoded
+	answer.Anchor.TXID = anchor.AnchorRecord.Bitcoin.TXID
+	answer.Anchor.BlockHash = anchor.AnchorRecord.Bitcoin.BlockHash
+	answer.Anchor.BlockHeight = anchor.AnchorRecord.Bitcoin.BlockHeight
+	return answer, nil
+}
+
+// Verify checks that the branch leads from Leaf to KeyMR.
+func (b *MerkleBranch) Verify() error {
+	hash, err := hex.DecodeString(b.Leaf)
+	if err != nil {
+		return err
+	}
+	for _, v := range b.Steps {
+		sibling, err := hex.DecodeString(v.Hash)
+		if err != nil {
+			return err
+		}
+		if v.Left == true {
+			hash = sha256Sum(sibling, hash)
+		} else {
+			hash = sha256Sum(hash, sibling)
+		}
+	}
+	headerHash, err := hex.DecodeString(b.HeaderHash)
+	if err != nil {
+		return err
+	}
+	keyMR := fmt.Sprintf("%x", sha256Sum(headerHash, hash))
+	if keyMR != b.KeyMR {
+		return fmt.Errorf("Merkle branch leads to %v, not %v", keyMR, b.KeyMR)
+	}
+	return nil
+}
+
+// VerifyEntryProof checks an EntryProof without needing anything but the
+// proof and the key anchor records are signed with. An unanchored proof only
+// proves the entry is part of the DBlock.
+func VerifyEntryProof(p *EntryProof, anchorPublicKey string) error {
+	if p.EntryData != "" {
+		data, err := hex.DecodeString(p.EntryData)
+		if err != nil {
+			return err
+		}
+		if fmt.Sprintf("%x", ComputeEntryHash(data)) != p.EntryHash {
+			return fmt.Errorf("Entry data does not match the entry hash")
+		}
+	}
+
+	if p.EntryBlock.Leaf != p.EntryHash {
+		return fmt.Errorf("Entry block branch does not start at the entry")
+	}
+	err := p.EntryBlock.Verify()
+	if err != nil {
+		return err
+	}
+
+	pair, err := hex.DecodeString(p.ChainID + p.EntryBlock.KeyMR)
+	if err != nil {
+		return err
+	}
+	if p.DBlock.Leaf != fmt.Sprintf("%x", sha256Sum(pair)) {
+		return fmt.Errorf("DBlock branch does not start at the entry block")
+	}
+	err = p.DBlock.Verify()
+	if err != nil {
+		return err
+	}
+
+	if p.Anchor == nil {
+		return nil
+	}
+	err = verifyAnchorSignature(p.Anchor.AnchorRecord, anchorPublicKey)
+	if err != nil {
+		return err
+	}
+	ar := new(AnchorRecord)
+	err = json.Unmarshal([]byte(p.Anchor.AnchorRecord[:len(p.Anchor.AnchorRecord)-128]), ar)
+	if err != nil {
+		return err
+	}
+	if ar.KeyMR != p.DBlock.KeyMR {
+		return fmt.Errorf("Anchor record anchors %v, not %v", ar.KeyMR, p.DBlock.KeyMR)
+	}
+	if int(ar.DBHeight) != p.DBlockHeight {
+		return fmt.Errorf("Anchor record anchors height %v, not %v", ar.DBHeight, p.DBlockHeight)
+	}
+	if ar.Bitcoin.TXID != p.Anchor.TXID || ar.Bitcoin.BlockHash != p.Anchor.BlockHash || ar.Bitcoin.BlockHeight != p.Anchor.BlockHeight {
+		return fmt.Errorf("Anchor record does not match the Bitcoin transaction")
+	}
+	return nil
+}
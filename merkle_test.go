@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/FactomProject/ed25519"
+)
+
+func TestEntryProof(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID := bytes.Repeat([]byte{0x11}, 32)
+
+	//An entry block with two entries and a minute marker
+	entryData := []byte{0x00, 0x01, 0x02}
+	entryHash := ComputeEntryHash(entryData)
+	otherHash := bytes.Repeat([]byte{0x22}, 32)
+	minuteMarker := append(make([]byte, 31), 0x01)
+	eHeader := bytes.Repeat([]byte{0x33}, EBlockHeaderSize)
+	eBodyMR := sha256Sum(sha256Sum(entryHash, otherHash), sha256Sum(minuteMarker, minuteMarker))
+	eKeyMR := fmt.Sprintf("%x", sha256Sum(sha256Sum(eHeader), eBodyMR))
+
+	block := new(Block)
+	block.ChainID = fmt.Sprintf("%x", chainID)
+	block.PartialHash = eKeyMR
+	block.FullHash = "f" + eKeyMR
+	block.DBlockHeight = 1
+	block.IsEntryBlock = true
+	block.BinaryString = fmt.Sprintf("%x%x%x%x", eHeader, entryHash, otherHash, minuteMarker)
+	entry := new(Entry)
+	entry.Hash = fmt.Sprintf("%x", entryHash)
+	entry.ChainID = block.ChainID
+	entry.BinaryString = fmt.Sprintf("%x", entryData)
+	entry.EntryBlock = eKeyMR
+	block.EntryList = []*Entry{entry}
+	err = SaveBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A DBlock with an admin block and the entry block
+	adminPair := append(append(make([]byte, 31), 0x0a), bytes.Repeat([]byte{0x44}, 32)...)
+	ePair, _ := hex.DecodeString(block.ChainID + eKeyMR)
+	dHeader := bytes.Repeat([]byte{0x55}, DBlockHeaderSize)
+	dBodyMR := sha256Sum(sha256Sum(adminPair), sha256Sum(ePair))
+	dKeyMR := fmt.Sprintf("%x", sha256Sum(sha256Sum(dHeader), dBodyMR))
+	saveTestDBlock(t, dKeyMR, zeroHash, 1)
+
+	//DBlocks stored without their marshalled form are not fetched from the node
+	_, err = BuildEntryProof(entry.Hash)
+	if err != ErrRawDBlockNotStored {
+		t.Fatalf("Wrong error without the marshalled DBlock - %v", err)
+	}
+	dBlock, err := LoadDBlock(dKeyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dBlock.BinaryString = fmt.Sprintf("%x", bytes.Join([][]byte{dHeader, adminPair, ePair}, nil))
+	err = SaveDBlock(dBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := BuildEntryProof(entry.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Anchor != nil {
+		t.Errorf("Unexpected anchor - %v", proof.Anchor)
+	}
+	err = VerifyEntryProof(proof, "")
+	if err != nil {
+		t.Errorf("Unanchored proof did not verify - %v", err)
+	}
+
+	//Anchor the DBlock
+	record := fmt.Sprintf(`{"AnchorRecordVer":1,"DBHeight":1,"KeyMR":"%v","Bitcoin":{"TXID":"tx1","BlockHash":"btc1","BlockHeight":100}}`, dKeyMR)
+	anchor := new(Entry)
+	anchor.Hash = "anchor1"
+	anchor.Content = &DecodedString{Decoded: record + fmt.Sprintf("%x", ed25519.Sign(priv, []byte(record))[:])}
+	anchor.AnchorRecord = new(AnchorRecord)
+	anchor.AnchorRecord.KeyMR = dKeyMR
+	anchor.AnchorRecord.Bitcoin.TXID = "tx1"
+	anchor.AnchorRecord.Bitcoin.BlockHash = "btc1"
+	anchor.AnchorRecord.Bitcoin.BlockHeight = 100
+	err = SaveEntry(anchor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dBlock, err = LoadDBlock(dKeyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dBlock.AnchorRecord = "anchor1"
+	err = SaveDBlock(dBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err = BuildEntryProof(entry.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Anchor == nil || proof.Anchor.TXID != "tx1" {
+		t.Fatalf("Wrong anchor - %v", proof.Anchor)
+	}
+	err = VerifyEntryProof(proof, fmt.Sprintf("%x", pub[:]))
+	if err != nil {
+		t.Errorf("Proof did not verify - %v", err)
+	}
+
+	err = VerifyEntryProof(proof, fmt.Sprintf("%x", bytes.Repeat([]byte{0x01}, 32)))
+	if err == nil {
+		t.Errorf("Proof verified against the wrong anchor key")
+	}
+	proof.DBlockHeight = 2
+	err = VerifyEntryProof(proof, fmt.Sprintf("%x", pub[:]))
+	if err == nil {
+		t.Errorf("Proof verified with an anchor record of another height")
+	}
+	proof.DBlockHeight = 1
+	proof.EntryBlock.Steps[0].Hash = fmt.Sprintf("%x", bytes.Repeat([]byte{0x23}, 32))
+	err = VerifyEntryProof(proof, fmt.Sprintf("%x", pub[:]))
+	if err == nil {
+		t.Errorf("Tampered proof verified")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/FactomProject/factom"
+)
+
+// NodeClient is the source of all the data the explorer synchronizes.
+// FactomdClient talks to a live factomd, FixtureClient serves data from memory
+// or from a fixture file for tests and offline replays.
+type NodeClient interface {
+	GetDBlockHead() (*factom.DBHead, error)
+	GetDBlock(keyMR string) (*factom.DBlock, error)
+	GetRaw(hash string) ([]byte, error)
+}
+
+// Node is the NodeClient used by the synchronization code.
+var Node NodeClient = new(FactomdClient)
+
+func init() {
+	fixtureFile := ReadConfig().Node.FixtureFile
+	if fixtureFile == "" {
+		return
+	}
+	fc, err := LoadFixtureClient(fixtureFile)
+	if err != nil {
+		panic(err)
+	}
+	Node = fc
+}
+
+//-----------------------------------------------------------------------------------------------
+//------------------------------------------Factomd----------------------------------------------
+//-----------------------------------------------------------------------------------------------
+
+// FactomdClient fetches data from factomd through the factom package.
+type FactomdClient struct{}
+
+var _ NodeClient = (*FactomdClient)(nil)
+
+func (c *FactomdClient) GetDBlockHead() (*factom.DBHead, error) {
+	return factom.GetDBlockHead()
+}
+
+func (c *FactomdClient) GetDBlock(keyMR string) (*factom.DBlock, error) {
+	return factom.GetDBlock(keyMR)
+}
+
+func (c *FactomdClient) GetRaw(hash string) ([]byte, error) {
+	return factom.GetRaw(hash)
+}
+
+//-----------------------------------------------------------------------------------------------
+//------------------------------------------Fixture----------------------------------------------
+//-----------------------------------------------------------------------------------------------
+
+// FixtureClient serves a fixed set of DBlocks and raw blocks.
+type FixtureClient struct {
+	mutex sync.RWMutex
+
+	Head    string
+	DBlocks map[string]*factom.DBlock
+	Raw     map[string]string //hex encoded raw data
+}
+
+var _ NodeClient = (*FixtureClient)(nil)
+
+func NewFixtureClient() *FixtureClient {
+	fc := new(FixtureClient)
+	fc.DBlocks = map[string]*factom.DBlock{}
+	fc.Raw = map[string]string{}
+	return fc
+}
+
+// LoadFixtureClient reads a FixtureClient previously written with Save.
+func LoadFixtureClient(filename string) (*FixtureClient, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	fc := NewFixtureClient()
+	err = json.Unmarshal(data, fc)
+	if err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+func (c *FixtureClient) Save(filename string) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+func (c *FixtureClient) SetHead(keyMR string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Head = keyMR
+}
+
+func (c *FixtureClient) AddDBlock(keyMR string, block *factom.DBlock) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.DBlocks[keyMR] = block
+}
+
+func (c *FixtureClient) AddRaw(hash string, raw []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Raw[hash] = fmt.Sprintf("%x", raw)
+}
+
+func (c *FixtureClient) GetDBlockHead() (*factom.DBHead, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.Head == "" {
+		return nil, fmt.Errorf("No DBlock head set")
+	}
+	head := new(factom.DBHead)
+	head.KeyMR = c.Head
+	return head, nil
+}
+
+func (c *FixtureClient) GetDBlock(keyMR string) (*factom.DBlock, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	block, found := c.DBlocks[keyMR]
+	if found == false {
+		return nil, fmt.Errorf("DBlock %v not found", keyMR)
+	}
+	return block, nil
+}
+
+func (c *FixtureClient) GetRaw(hash string) ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	raw, found := c.Raw[hash]
+	if found == false {
+		return nil, fmt.Errorf("Raw data for %v not found", hash)
+	}
+	return hex.DecodeString(raw)
+}
+
+//-----------------------------------------------------------------------------------------------
+//-----------------------------------------Recording---------------------------------------------
+//-----------------------------------------------------------------------------------------------
+
+// RecordingClient forwards every call to another NodeClient and keeps a copy
+// of every successful answer in a FixtureClient, so a live session can be
+// saved and replayed offline later.
+type RecordingClient struct {
+	Client  NodeClient
+	Fixture *FixtureClient
+}
+
+var _ NodeClient = (*RecordingClient)(nil)
+
+func NewRecordingClient(client NodeClient) *RecordingClient {
+	rc := new(RecordingClient)
+	rc.Client = client
+	rc.Fixture = NewFixtureClient()
+	return rc
+}
+
+func (c *RecordingClient) GetDBlockHead() (*factom.DBHead, error) {
+	head, err := c.Client.GetDBlockHead()
+	if err != nil {
+		return nil, err
+	}
+	c.Fixture.SetHead(head.KeyMR)
+	return head, nil
+}
+
+func (c *RecordingClient) GetDBlock(keyMR string) (*factom.DBlock, error) {
+	block, err := c.Client.GetDBlock(keyMR)
+	if err != nil {
+		return nil, err
+	}
+	c.Fixture.AddDBlock(keyMR, block)
+	return block, nil
+}
+
+func (c *RecordingClient) GetRaw(hash string) ([]byte, error) {
+	raw, err := c.Client.GetRaw(hash)
+	if err != nil {
+		return nil, err
+	}
+	c.Fixture.AddRaw(hash, raw)
+	return raw, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/FactomProject/factom"
+)
+
+func TestFixtureClientSaveLoad(t *testing.T) {
+	fc := NewFixtureClient()
+	fc.SetHead("aa")
+	dBlock := new(factom.DBlock)
+	dBlock.Header.SequenceNumber = 5
+	fc.AddDBlock("aa", dBlock)
+	fc.AddRaw("bb", []byte{0x01, 0x02, 0x03})
+
+	file, err := ioutil.TempFile("", "fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	err = fc.Save(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFixtureClient(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := loaded.GetDBlockHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.KeyMR != "aa" {
+		t.Errorf("Wrong head - %v", head.KeyMR)
+	}
+	block, err := loaded.GetDBlock("aa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Header.SequenceNumber != 5 {
+		t.Errorf("Wrong sequence number - %v", block.Header.SequenceNumber)
+	}
+	raw, err := loaded.GetRaw("bb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 3 || raw[2] != 0x03 {
+		t.Errorf("Wrong raw data - %x", raw)
+	}
+	_, err = loaded.GetRaw("cc")
+	if err == nil {
+		t.Errorf("Expected an error for unknown raw data")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// SyncProgress describes how far the current synchronization pass has come.
+type SyncProgress struct {
+	Syncing bool
+
+	StartHeight   int
+	CurrentHeight int
+	TargetHeight  int
+
+	StartTime       time.Time
+	BlocksPerSecond float64
+	ETA             time.Duration
+}
+
+// Percent returns how much of the current pass is done, 0-100.
+func (p SyncProgress) Percent() float64 {
+	total := p.TargetHeight - p.StartHeight
+	if total <= 0 {
+		return 100
+	}
+	return 100 * float64(p.CurrentHeight-p.StartHeight) / float64(total)
+}
+
+// ProgressTracker is a SyncProgress shared between the sync goroutine and the web handlers.
+type ProgressTracker struct {
+	mutex    sync.RWMutex
+	progress SyncProgress
+}
+
+var Progress = new(ProgressTracker)
+
+func (t *ProgressTracker) Start(startHeight, targetHeight int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress = SyncProgress{}
+	t.progress.Syncing = true
+	t.progress.StartHeight = startHeight
+	t.progress.CurrentHeight = startHeight
+	t.progress.TargetHeight = targetHeight
+	t.progress.StartTime = time.Now()
+
+	log.Printf("Synchronizing dblocks %v to %v", startHeight, targetHeight)
+}
+
+func (t *ProgressTracker) Update(currentHeight int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	p := &t.progress
+	p.CurrentHeight = currentHeight
+	elapsed := time.Since(p.StartTime).Seconds()
+	if elapsed > 0 {
+		p.BlocksPerSecond = float64(p.CurrentHeight-p.StartHeight) / elapsed
+	}
+	if p.BlocksPerSecond > 0 {
+		remaining := float64(p.TargetHeight - p.CurrentHeight)
+		p.ETA = time.Duration(remaining/p.BlocksPerSecond) * time.Second
+	}
+
+	log.Printf("Synchronized dblock %v / %v - %.2f blocks/s, ETA %v", p.CurrentHeight, p.TargetHeight, p.BlocksPerSecond, p.ETA)
+}
+
+func (t *ProgressTracker) Finish() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.Syncing = false
+	t.progress.ETA = 0
+}
+
+func (t *ProgressTracker) Get() SyncProgress {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.progress
+}
+
+// SyncStatus is what the status page and the status API report.
+type SyncStatus struct {
+	DataStatusStruct
+	Progress SyncProgress
+	Caches   []CacheStats
+}
+
+func GetSyncStatus() SyncStatus {
+	return SyncStatus{DataStatusStruct: GetDataStatus(), Progress: Progress.Get(), Caches: GetCacheStats()}
+}
@@ -0,0 +1,312 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// CheckForReorg makes sure the last DBlock we have synchronized is still part
+// of the node's chain and returns the headers of the DBlocks to synchronize,
+// newest first. If it is not (a fork, a reset testnet, a rebuilt node), every
+// DBlock above the last one both chains share is rolled back together with
+// everything derived from it, and the event is recorded. The node's chain is
+// walked only once for both.
+func CheckForReorg(headKeyMR string, dataStatus *DataStatusStruct) ([]*DBlock, error) {
+	var lastKnown *DBlock
+	minHeight := -1
+	if IsHashZeroes(dataStatus.LastKnownBlock) == false {
+		var err error
+		lastKnown, err = LoadDBlock(dataStatus.LastKnownBlock)
+		if err != nil {
+			return nil, err
+		}
+		if lastKnown != nil {
+			minHeight = lastKnown.SequenceNumber
+		}
+	}
+
+	//Walk the node's chain back to the height of our last known block
+	toSync, block, err := CollectDBlocksToSync(headKeyMR, dataStatus.LastKnownBlock, minHeight)
+	if err != nil {
+		return nil, err
+	}
+	if lastKnown == nil || block == nil {
+		return toSync, nil
+	}
+
+	//Our last known block is not in the node's chain - find where the chains meet
+	forkHeight := -1
+	forkKeyMR := "0000000000000000000000000000000000000000000000000000000000000000"
+	for {
+		stored, err := LoadDBlockKeyMRBySequence(block.SequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+		if stored == block.KeyMR {
+			forkHeight = block.SequenceNumber
+			forkKeyMR = block.KeyMR
+			break
+		}
+		toSync = append(toSync, block)
+		if IsHashZeroes(block.PrevBlockKeyMR) {
+			break
+		}
+		block, err = loadOrFetchDBlock(block.PrevBlockKeyMR)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Chain reorganization detected - last known block %v at height %v is not in the node's chain, rolling back to height %v", lastKnown.KeyMR, lastKnown.SequenceNumber, forkHeight)
+
+	//The rollback, its record and the reset checkpoint are committed together
+	err = RunInBatch(func() error {
+		orphaned, err := RollbackToHeight(forkHeight, dataStatus.DBlockHeight)
+		if err != nil {
+			return err
+		}
+
+		event := new(ReorgEvent)
+		event.Time = time.Now()
+		event.ForkHeight = forkHeight
+		event.ForkKeyMR = forkKeyMR
+		event.OldHead = dataStatus.LastKnownBlock
+		event.OldHeight = dataStatus.DBlockHeight
+		event.NewHead = headKeyMR
+		event.OrphanedDBlocks = orphaned
+		err = SaveReorgEvent(event)
+		if err != nil {
+			return err
+		}
+
+		dataStatus.LastKnownBlock = forkKeyMR
+		dataStatus.DBlockHeight = forkHeight
+		if dataStatus.DBlockHeight < 0 {
+			dataStatus.DBlockHeight = 0
+		}
+		processed, err := LoadDBlock(dataStatus.LastProcessedBlock)
+		if err != nil {
+			return err
+		}
+		if processed == nil || processed.SequenceNumber > forkHeight {
+			dataStatus.LastProcessedBlock = forkKeyMR
+		}
+		dataStatus.Reorgs++
+		return SaveDataStatus(dataStatus)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toSync, nil
+}
+
+func loadOrFetchDBlock(keyMR string) (*DBlock, error) {
+	block, err := LoadDBlock(keyMR)
+	if err != nil {
+		return nil, err
+	}
+	if block != nil {
+		return block, nil
+	}
+	return GetDBlockFromFactom(keyMR)
+}
+
+// RollbackToHeight removes every stored DBlock above the given height,
+// newest first, and returns the KeyMRs of the removed DBlocks.
+func RollbackToHeight(height, maxHeight int) ([]string, error) {
+	//Blocks from an interrupted sync can sit above maxHeight
+	top := maxHeight
+	for {
+		key, err := LoadDBlockKeyMRBySequence(top + 1)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			break
+		}
+		top++
+	}
+
+	orphaned := []string{}
+	for i := top; i > height; i-- {
+		block, err := LoadDBlockBySequence(i)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			continue
+		}
+		err = RollbackDBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		orphaned = append(orphaned, block.KeyMR)
+	}
+	return orphaned, nil
+}
+
+// RollbackDBlock removes a DBlock along with its blocks, entries, block
+// indexes, sequence index and any chain or anchor data it introduced.
+func RollbackDBlock(dBlock *DBlock) error {
+	log.Printf("Rolling back dblock %v at height %v", dBlock.KeyMR, dBlock.SequenceNumber)
+
+	blockList := []ListEntry{}
+	blockList = append(blockList, dBlock.EntryBlockList...)
+	blockList = append(blockList, dBlock.AdminBlock, dBlock.EntryCreditBlock, dBlock.FactoidBlock)
+
+	for _, v := range blockList {
+		if v.KeyMR == "" {
+			continue
+		}
+		block, err := LoadBlock(v.KeyMR)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			continue
+		}
+		err = RollbackBlock(block)
+		if err != nil {
+			return err
+		}
+	}
+
+	previous, err := LoadDBlock(dBlock.PrevBlockKeyMR)
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.NextBlockKeyMR == dBlock.KeyMR {
+		unlinked := *previous
+		unlinked.NextBlockKeyMR = ""
+		err = SaveDBlock(&unlinked)
+		if err != nil {
+			return err
+		}
+	}
+
+	return DeleteDBlock(dBlock)
+}
+
+func RollbackBlock(block *Block) error {
+	if IsAnchorChainID(block.ChainID) {
+		for _, v := range block.EntryList {
+			if v.AnchorRecord == nil {
+				continue
+			}
+			anchored, err := LoadDBlock(v.AnchorRecord.KeyMR)
+			if err != nil {
+				return err
+			}
+			if anchored != nil && anchored.AnchorRecord == v.Hash {
+				err = DeleteAnchorTransaction(anchored.AnchoredInTransaction)
+				if err != nil {
+					return err
+				}
+				unanchored := *anchored
+				unanchored.AnchorRecord = ""
+				unanchored.AnchoredInTransaction = ""
+				unanchored.AnchorTimestamp = 0
+				unanchored.AnchorVerified = false
+				unanchored.AnchorVerificationErrors = nil
+				err = SaveDBlock(&unanchored)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if block.IsEntryCreditBlock {
+		err := UnindexBlockCommits(block)
+		if err != nil {
+			return err
+		}
+	}
+	if block.IsAdminBlock {
+		err := UnindexBlockAdminEvents(block)
+		if err != nil {
+			return err
+		}
+	}
+	if block.IsFactoidBlock || block.IsEntryCreditBlock {
+		err := UnindexBlockAddresses(block)
+		if err != nil {
+			return err
+		}
+	}
+	if block.IsFactoidBlock {
+		for _, v := range block.EntryList {
+			err := DeleteTransaction(v.Hash)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	head, err := LoadChainHead(block.ChainID)
+	if err != nil {
+		return err
+	}
+	if head == block.PartialHash {
+		if IsHashZeroes(block.PrevBlockHash) {
+			err = DeleteChainHead(block.ChainID)
+		} else {
+			err = SaveChainHead(block.ChainID, block.PrevBlockHash)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if block.IsEntryBlock && IsHashZeroes(block.PrevBlockHash) {
+		chain, err := LoadChain(block.ChainID)
+		if err != nil {
+			return err
+		}
+		if chain != nil {
+			err = DeleteChain(chain)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		previous, err := LoadBlock(block.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		if previous != nil && previous.NextBlockHash == block.PartialHash {
+			unlinked := *previous
+			unlinked.NextBlockHash = ""
+			err = SaveBlock(&unlinked)
+			if err != nil {
+				return err
+			}
+		}
+		if block.IsEntryBlock {
+			chain, err := LoadChain(block.ChainID)
+			if err != nil {
+				return err
+			}
+			if chain != nil {
+				updated := *chain
+				updated.HeadKeyMR = block.PrevBlockHash
+				updated.EntryBlockCount--
+				updated.EntryCount -= block.EntryCount
+				updated.TotalBytes -= BlockEntriesSize(block)
+				if previous != nil {
+					updated.LastDBlockHeight = previous.DBlockHeight
+				}
+				err = SaveChain(&updated)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return DeleteBlock(block)
+}
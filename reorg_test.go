@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/FactomProject/factom"
+)
+
+const zeroHash string = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// resetTestData points the explorer at an empty in-memory store and the given node.
+func resetTestData(node NodeClient) {
+	cfg.UseDatabase = false
+	InitCaches(CacheConfig{})
+	DataStatus = nil
+	Node = node
+}
+
+func addFixtureDBlock(fc *FixtureClient, keyMR, prev string, height int) {
+	block := new(factom.DBlock)
+	block.Header.PrevBlockKeyMR = prev
+	block.Header.SequenceNumber = height
+	fc.AddDBlock(keyMR, block)
+}
+
+func saveTestDBlock(t *testing.T, keyMR, prev string, height int) {
+	block := new(DBlock)
+	block.KeyMR = keyMR
+	block.PrevBlockKeyMR = prev
+	block.SequenceNumber = height
+	err := SaveDBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dBlockCountingClient counts the DBlocks fetched from the node.
+type dBlockCountingClient struct {
+	NodeClient
+	fetched map[string]int
+}
+
+func (c *dBlockCountingClient) GetDBlock(keyMR string) (*factom.DBlock, error) {
+	c.fetched[keyMR]++
+	return c.NodeClient.GetDBlock(keyMR)
+}
+
+func TestCheckForReorg(t *testing.T) {
+	fc := NewFixtureClient()
+	resetTestData(fc)
+
+	saveTestDBlock(t, "a0", zeroHash, 0)
+	saveTestDBlock(t, "a1", "a0", 1)
+	saveTestDBlock(t, "a2", "a1", 2)
+	saveTestDBlock(t, "a3", "a2", 3)
+	ds := LoadDataStatus()
+	ds.LastKnownBlock = "a3"
+	ds.LastProcessedBlock = "a3"
+	ds.DBlockHeight = 3
+
+	addFixtureDBlock(fc, "a0", zeroHash, 0)
+	addFixtureDBlock(fc, "a1", "a0", 1)
+	addFixtureDBlock(fc, "b2", "a1", 2)
+	addFixtureDBlock(fc, "b3", "b2", 3)
+	addFixtureDBlock(fc, "b4", "b3", 4)
+	fc.SetHead("b4")
+
+	counter := &dBlockCountingClient{NodeClient: fc, fetched: map[string]int{}}
+	Node = counter
+	toSync, err := CheckForReorg("b4", ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toSync) != 3 || toSync[0].KeyMR != "b4" || toSync[2].KeyMR != "b2" {
+		t.Errorf("Wrong dblocks to synchronize - %v", toSync)
+	}
+	for k, v := range counter.fetched {
+		if v > 1 {
+			t.Errorf("DBlock %v was fetched %v times", k, v)
+		}
+	}
+	if ds.LastKnownBlock != "a1" || ds.DBlockHeight != 1 || ds.LastProcessedBlock != "a1" {
+		t.Errorf("Wrong data status after reorg - %v", ds)
+	}
+	if ds.Reorgs != 1 {
+		t.Errorf("Reorg not counted - %v", ds.Reorgs)
+	}
+	for _, v := range []string{"a2", "a3"} {
+		block, err := LoadDBlock(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block != nil {
+			t.Errorf("Orphaned dblock %v was not rolled back", v)
+		}
+	}
+	key, err := LoadDBlockKeyMRBySequence(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		t.Errorf("Sequence index still points at %v", key)
+	}
+	block, err := LoadDBlock("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block == nil {
+		t.Errorf("Common ancestor was rolled back")
+	}
+}
+
+func TestCheckForReorgNoFork(t *testing.T) {
+	fc := NewFixtureClient()
+	resetTestData(fc)
+
+	saveTestDBlock(t, "a0", zeroHash, 0)
+	saveTestDBlock(t, "a1", "a0", 1)
+	ds := LoadDataStatus()
+	ds.LastKnownBlock = "a1"
+	ds.DBlockHeight = 1
+
+	addFixtureDBlock(fc, "a0", zeroHash, 0)
+	addFixtureDBlock(fc, "a1", "a0", 1)
+	addFixtureDBlock(fc, "a2", "a1", 2)
+	fc.SetHead("a2")
+
+	toSync, err := CheckForReorg("a2", ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.LastKnownBlock != "a1" || ds.Reorgs != 0 {
+		t.Errorf("Unexpected reorg - %v", ds)
+	}
+	if len(toSync) != 1 || toSync[0].KeyMR != "a2" {
+		t.Errorf("Wrong dblocks to synchronize - %v", toSync)
+	}
+}
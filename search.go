@@ -0,0 +1,137 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SearchResult is one of the things a search string turned out to be.
+type SearchResult struct {
+	Type  string
+	Title string
+	URL   string
+}
+
+// Search figures out what a search string refers to - a DBlock by KeyMR or
+// height, a block by either of its hashes, an entry, a Factoid transaction, a
+// chain by ID or name, an address or a Bitcoin anchor transaction - and
+// returns every match.
+func Search(text string) ([]SearchResult, error) {
+	text = strings.TrimSpace(text)
+	answer := []SearchResult{}
+	if text == "" {
+		return answer, nil
+	}
+
+	height, err := strconv.Atoi(text)
+	if err == nil && height >= 0 {
+		keyMR, err := LoadDBlockKeyMRBySequence(height)
+		if err != nil {
+			return nil, err
+		}
+		if keyMR != "" {
+			answer = append(answer, SearchResult{Type: "Directory Block", Title: fmt.Sprintf("Directory block %v", height), URL: fmt.Sprintf("/dblock/height/%v", height)})
+		}
+	}
+
+	if IsValidHash(strings.ToLower(text)) {
+		results, err := searchHash(strings.ToLower(text))
+		if err != nil {
+			return nil, err
+		}
+		answer = append(answer, results...)
+	}
+
+	chainID, err := LoadChainIDByName(text)
+	if err != nil {
+		return nil, err
+	}
+	if chainID != "" {
+		answer = append(answer, SearchResult{Type: "Chain", Title: fmt.Sprintf("Chain named %v", text), URL: "/chain/" + chainID})
+	}
+
+	addressType, _, err := ParseAddress(text)
+	if err == nil {
+		if IsPrivateKeyType(addressType) {
+			//Private keys never go in a URL, they are answered in place
+			answer = append(answer, SearchResult{Type: addressType, Title: "Private key - anyone who knows it can spend its funds, never share it"})
+		} else {
+			answer = append(answer, SearchResult{Type: addressType, Title: text, URL: "/address/" + text})
+		}
+	}
+
+	return answer, nil
+}
+
+func searchHash(hash string) ([]SearchResult, error) {
+	answer := []SearchResult{}
+
+	dBlock, err := LoadDBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	if dBlock != nil {
+		answer = append(answer, SearchResult{Type: "Directory Block", Title: fmt.Sprintf("Directory block %v", dBlock.SequenceNumber), URL: "/dblock/" + hash})
+	}
+
+	index, err := LoadBlockIndex(hash)
+	if err != nil {
+		return nil, err
+	}
+	if index != "" {
+		block, err := LoadBlock(index)
+		if err != nil {
+			return nil, err
+		}
+		if block != nil {
+			answer = append(answer, blockSearchResult(block))
+		}
+	}
+
+	entry, err := LoadEntry(hash)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if entry.ChainID == "000000000000000000000000000000000000000000000000000000000000000f" {
+			answer = append(answer, SearchResult{Type: "Factoid Transaction", Title: hash, URL: "/tx/" + hash})
+		} else {
+			answer = append(answer, SearchResult{Type: "Entry", Title: hash, URL: "/entry/" + hash})
+		}
+	}
+
+	chain, err := LoadChain(hash)
+	if err != nil {
+		return nil, err
+	}
+	if chain != nil {
+		answer = append(answer, SearchResult{Type: "Chain", Title: hash, URL: "/chain/" + hash})
+	}
+
+	anchored, err := LoadDBlockKeyMRByAnchorTransaction(hash)
+	if err != nil {
+		return nil, err
+	}
+	if anchored != "" {
+		answer = append(answer, SearchResult{Type: "Bitcoin Anchor Transaction", Title: fmt.Sprintf("Anchor of directory block %v", anchored), URL: "/dblock/" + anchored})
+	}
+
+	return answer, nil
+}
+
+func blockSearchResult(block *Block) SearchResult {
+	switch {
+	case block.IsAdminBlock:
+		return SearchResult{Type: "Admin Block", Title: block.PartialHash, URL: "/ablock/" + block.PartialHash}
+	case block.IsEntryCreditBlock:
+		return SearchResult{Type: "Entry Credit Block", Title: block.PartialHash, URL: "/ecblock/" + block.PartialHash}
+	case block.IsFactoidBlock:
+		return SearchResult{Type: "Factoid Block", Title: block.PartialHash, URL: "/fblock/" + block.PartialHash}
+	}
+	return SearchResult{Type: "Entry Block", Title: block.PartialHash, URL: "/eblock/" + block.PartialHash}
+}
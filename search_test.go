@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	dBlockKeyMR := "d000000000000000000000000000000000000000000000000000000000000001"
+	saveTestDBlock(t, dBlockKeyMR, zeroHash, 1)
+	chainID := "c000000000000000000000000000000000000000000000000000000000000001"
+	saveTestEntryBlock(t, chainID, "b000000000000000000000000000000000000000000000000000000000000001", zeroHash, 2, "e000000000000000000000000000000000000000000000000000000000000001")
+	err := SaveChainIDsByName(chainID, "MyChain", "4d79436861696e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveAnchorTransaction("a000000000000000000000000000000000000000000000000000000000000001", dBlockKeyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(text string) []SearchResult {
+		results, err := Search(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	tests := []struct {
+		Text string
+		Type string
+		URL  string
+	}{
+		{"1", "Directory Block", "/dblock/height/1"},
+		{"B000000000000000000000000000000000000000000000000000000000000001", "Entry Block", "/eblock/b000000000000000000000000000000000000000000000000000000000000001"},
+		{"e000000000000000000000000000000000000000000000000000000000000001", "Entry", "/entry/e000000000000000000000000000000000000000000000000000000000000001"},
+		{chainID, "Chain", "/chain/" + chainID},
+		{"MyChain", "Chain", "/chain/" + chainID},
+		{"a000000000000000000000000000000000000000000000000000000000000001", "Bitcoin Anchor Transaction", "/dblock/" + dBlockKeyMR},
+		{"FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q", "Factoid Address", "/address/FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"},
+	}
+	for _, v := range tests {
+		results := search(v.Text)
+		if len(results) != 1 || results[0].Type != v.Type || results[0].URL != v.URL {
+			t.Errorf("Wrong results for %v - %v", v.Text, results)
+		}
+	}
+
+	//Private keys are recognized but never linked to
+	results := search("Fs1KWJrpLdfucvmYwN2nWrwepLn8ercpMbzXshd1g8zyhKXLVLWj")
+	if len(results) != 1 || results[0].Type != AddressTypeFactoidPrivate || results[0].URL != "" {
+		t.Errorf("Wrong results for a private key - %v", results)
+	}
+	address, err := GetAddressInformation("Fs1KWJrpLdfucvmYwN2nWrwepLn8ercpMbzXshd1g8zyhKXLVLWj", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address.Address != "" || address.AddressType != AddressTypeFactoidPrivate {
+		t.Errorf("Private key echoed back - %v", address)
+	}
+
+	if results := search("nothing"); len(results) != 0 {
+		t.Errorf("Expected no results - %v", results)
+	}
+
+	//A chain named after a DBlock height is ambiguous
+	err = SaveChainIDsByName(chainID, "1", "31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := search("1"); len(results) != 2 {
+		t.Errorf("Expected two results - %v", results)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/block"
+)
+
+// Transaction is a decoded Factoid transaction.
+type Transaction struct {
+	TxID      string
+	Timestamp string
+
+	//Factoid block the transaction was included in and the height of its DBlock
+	FBlock       string
+	DBlockHeight int
+
+	Inputs    []TransactionAddress
+	Outputs   []TransactionAddress
+	ECOutputs []TransactionAddress
+
+	//Amounts are in factoshis
+	TotalInputs    uint64
+	TotalOutputs   uint64
+	TotalECOutputs uint64
+	Fee            uint64
+
+	RCDs       []string
+	Signatures []string
+}
+
+type TransactionAddress struct {
+	Address string //human readable FA or EC address
+	Hash    string
+	Amount  uint64
+}
+
+// FeeString returns the fee in Factoids.
+func (t *Transaction) FeeString() string {
+	return factoid.ConvertDecimalToString(t.Fee)
+}
+
+// AmountString returns the amount in Factoids.
+func (a TransactionAddress) AmountString() string {
+	return factoid.ConvertDecimalToString(a.Amount)
+}
+
+// ParseFactoidTransaction decodes a Factoid transaction.
+func ParseFactoidTransaction(v factoid.ITransaction) (*Transaction, error) {
+	answer := new(Transaction)
+	answer.TxID = v.GetHash().String()
+	answer.Timestamp = TimestampToString(v.GetMilliTimestamp() / 1000)
+
+	for _, in := range v.GetInputs() {
+		answer.Inputs = append(answer.Inputs, TransactionAddress{
+			Address: factoid.ConvertFctAddressToUserStr(in.GetAddress()),
+			Hash:    in.GetAddress().String(),
+			Amount:  in.GetAmount(),
+		})
+	}
+	for _, out := range v.GetOutputs() {
+		answer.Outputs = append(answer.Outputs, TransactionAddress{
+			Address: factoid.ConvertFctAddressToUserStr(out.GetAddress()),
+			Hash:    out.GetAddress().String(),
+			Amount:  out.GetAmount(),
+		})
+	}
+	for _, out := range v.GetECOutputs() {
+		answer.ECOutputs = append(answer.ECOutputs, TransactionAddress{
+			Address: factoid.ConvertECAddressToUserStr(out.GetAddress()),
+			Hash:    out.GetAddress().String(),
+			Amount:  out.GetAmount(),
+		})
+	}
+
+	var err error
+	answer.TotalInputs, err = v.TotalInputs()
+	if err != nil {
+		return nil, err
+	}
+	answer.TotalOutputs, err = v.TotalOutputs()
+	if err != nil {
+		return nil, err
+	}
+	answer.TotalECOutputs, err = v.TotalECs()
+	if err != nil {
+		return nil, err
+	}
+	//Whatever the inputs do not pay out is the fee
+	if answer.TotalInputs > answer.TotalOutputs+answer.TotalECOutputs {
+		answer.Fee = answer.TotalInputs - answer.TotalOutputs - answer.TotalECOutputs
+	}
+
+	for _, rcd := range v.GetRCDs() {
+		bin, err := rcd.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		answer.RCDs = append(answer.RCDs, fmt.Sprintf("%x", bin))
+	}
+	for _, sigBlock := range v.GetSignatureBlocks() {
+		if sigBlock == nil {
+			continue
+		}
+		for _, sig := range sigBlock.GetSignatures() {
+			bin, err := sig.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			answer.Signatures = append(answer.Signatures, fmt.Sprintf("%x", bin))
+		}
+	}
+
+	return answer, nil
+}
+
+// ParseFactoidBlockTransactions decodes every transaction of a stored Factoid block.
+func ParseFactoidBlockTransactions(b *Block) ([]*Transaction, error) {
+	raw, err := hex.DecodeString(b.BinaryString)
+	if err != nil {
+		return nil, err
+	}
+	fBlock := new(block.FBlock)
+	_, err = fBlock.UnmarshalBinaryData(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := []*Transaction{}
+	for _, v := range fBlock.GetTransactions() {
+		tx, err := ParseFactoidTransaction(v)
+		if err != nil {
+			return nil, err
+		}
+		tx.FBlock = b.PartialHash
+		tx.DBlockHeight = b.DBlockHeight
+		answer = append(answer, tx)
+	}
+	return answer, nil
+}
+
+// SaveFactoidBlockTransactions stores every transaction of a Factoid block.
+func SaveFactoidBlockTransactions(b *Block) error {
+	txs, err := ParseFactoidBlockTransactions(b)
+	if err != nil {
+		return err
+	}
+	for _, v := range txs {
+		err = SaveTransaction(v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func SaveTransaction(t *Transaction) error {
+	err := SaveData(TransactionsBucket, t.TxID, t)
+	if err != nil {
+		return err
+	}
+	Transactions.Set(t.TxID, t)
+	return nil
+}
+
+func LoadTransaction(txID string) (*Transaction, error) {
+	cached, found := Transactions.Get(txID)
+	if found == true {
+		return cached.(*Transaction), nil
+	}
+
+	tx := new(Transaction)
+	tx2, err := LoadData(TransactionsBucket, txID, tx)
+	if err != nil {
+		return nil, err
+	}
+	if tx2 == nil {
+		return nil, nil
+	}
+	Transactions.Set(txID, tx)
+	return tx, nil
+}
+
+func DeleteTransaction(txID string) error {
+	err := DeleteData(TransactionsBucket, txID)
+	if err != nil {
+		return err
+	}
+	Transactions.Delete(txID)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTransactionRollback(t *testing.T) {
+	resetTestData(NewFixtureClient())
+
+	tx := new(Transaction)
+	tx.TxID = "t1"
+	tx.FBlock = "fb1"
+	tx.Inputs = []TransactionAddress{TransactionAddress{Address: "FA1", Amount: 1000}}
+	tx.TotalInputs = 1000
+	err := SaveTransaction(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := new(Block)
+	block.ChainID = "000000000000000000000000000000000000000000000000000000000000000f"
+	block.PartialHash = "fb1"
+	block.FullHash = "ffb1"
+	block.PrevBlockHash = zeroHash
+	block.IsFactoidBlock = true
+	entry := new(Entry)
+	entry.Hash = "t1"
+	block.EntryList = []*Entry{entry}
+	err = SaveBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadTransaction("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded == nil || loaded.Inputs[0].Address != "FA1" {
+		t.Errorf("Wrong transaction - %v", loaded)
+	}
+
+	err = RollbackBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadTransaction("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != nil {
+		t.Errorf("Transaction was not rolled back")
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// QuarantinedBlock is a block that failed verification during synchronization.
+// It is kept for inspection instead of being saved.
+type QuarantinedBlock struct {
+	Time time.Time
+
+	//KeyMR the DBlock referenced the block by, or the DBlock's own KeyMR
+	Hash         string
+	ChainID      string
+	DBlockKeyMR  string
+	DBlockHeight int
+
+	Reasons      []string
+	BinaryString string
+}
+
+// VerificationError is returned when some of the blocks of a DBlock fail
+// verification. None of them have been saved.
+type VerificationError struct {
+	DBlockKeyMR string
+	Blocks      []*QuarantinedBlock
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%v blocks of DBlock %v failed verification", len(e.Blocks), e.DBlockKeyMR)
+}
+
+// ComputeEBlockKeyMR computes the KeyMR of a marshalled entry block.
+func ComputeEBlockKeyMR(raw []byte) (string, error) {
+	header, leaves, err := SplitEBlock(raw)
+	if err != nil {
+		return "", err
+	}
+	bodyMR, _ := ComputeMerkleRoot(leaves, 0)
+	return fmt.Sprintf("%x", sha256Sum(sha256Sum(header), bodyMR)), nil
+}
+
+// ComputeDBlockKeyMR computes the KeyMR of a marshalled DBlock.
+func ComputeDBlockKeyMR(raw []byte) (string, error) {
+	header, leaves, err := SplitDBlock(raw)
+	if err != nil {
+		return "", err
+	}
+	bodyMR, _ := ComputeMerkleRoot(leaves, 0)
+	return fmt.Sprintf("%x", sha256Sum(sha256Sum(header), bodyMR)), nil
+}
+
+// VerifyDBlock checks a DBlock and the blocks fetched for it before they are
+// saved - that the marshalled DBlock hashes to its KeyMR and lists the blocks
+// we fetched, that the blocks hash to the KeyMRs the DBlock references them
+// by, that entries hash to their own hashes and that the DBlock and every
+// block link back to what we already have. It returns the blocks that failed.
+func VerifyDBlock(body *DBlock, blocks []*Block) ([]*QuarantinedBlock, error) {
+	answer := []*QuarantinedBlock{}
+
+	reasons, err := verifyDBlockBody(body)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := LoadDBlockBySequence(body.SequenceNumber - 1)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil && prev.KeyMR != body.PrevBlockKeyMR {
+		reasons = append(reasons, fmt.Sprintf("Previous DBlock %v does not match the DBlock at height %v, %v", body.PrevBlockKeyMR, prev.SequenceNumber, prev.KeyMR))
+	}
+	if len(reasons) > 0 {
+		q := newQuarantinedBlock(body, body.KeyMR, "")
+		q.Reasons = reasons
+		q.BinaryString = body.BinaryString
+		answer = append(answer, q)
+	}
+
+	for i, v := range body.EntryBlockList {
+		block := blocks[i]
+		reasons, err := verifyBlock(v, block, body.SequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		q := newQuarantinedBlock(body, v.KeyMR, v.ChainID)
+		q.Reasons = reasons
+		q.BinaryString = block.BinaryString
+		answer = append(answer, q)
+	}
+	return answer, nil
+}
+
+func verifyDBlockBody(body *DBlock) ([]string, error) {
+	reasons := []string{}
+
+	raw, err := hex.DecodeString(body.BinaryString)
+	if err != nil {
+		return nil, err
+	}
+	keyMR, err := ComputeDBlockKeyMR(raw)
+	if err != nil {
+		reasons = append(reasons, err.Error())
+		return reasons, nil
+	}
+	if keyMR != body.KeyMR {
+		reasons = append(reasons, fmt.Sprintf("DBlock hashes to %v", keyMR))
+	}
+
+	_, pairs, _ := splitBlock(raw, DBlockHeaderSize, 64)
+	if len(pairs) != len(body.EntryBlockList) {
+		reasons = append(reasons, fmt.Sprintf("DBlock lists %v blocks, not %v", len(pairs), len(body.EntryBlockList)))
+		return reasons, nil
+	}
+	for i, v := range body.EntryBlockList {
+		if fmt.Sprintf("%x", pairs[i]) != v.ChainID+v.KeyMR {
+			reasons = append(reasons, fmt.Sprintf("DBlock lists block %x at position %v, not %v", pairs[i][32:], i, v.KeyMR))
+		}
+	}
+	return reasons, nil
+}
+
+func newQuarantinedBlock(body *DBlock, hash, chainID string) *QuarantinedBlock {
+	q := new(QuarantinedBlock)
+	q.Time = time.Now()
+	q.Hash = hash
+	q.ChainID = chainID
+	q.DBlockKeyMR = body.KeyMR
+	q.DBlockHeight = body.SequenceNumber
+	return q
+}
+
+func verifyBlock(ref ListEntry, block *Block, height int) ([]string, error) {
+	reasons := []string{}
+
+	if block.ChainID != ref.ChainID {
+		reasons = append(reasons, fmt.Sprintf("Block belongs to chain %v", block.ChainID))
+	}
+	if block.PartialHash != ref.KeyMR && block.FullHash != ref.KeyMR {
+		reasons = append(reasons, fmt.Sprintf("Computed KeyMR %v does not match", block.PartialHash))
+	}
+
+	if block.IsEntryBlock {
+		raw, err := hex.DecodeString(block.BinaryString)
+		if err != nil {
+			return nil, err
+		}
+		keyMR, err := ComputeEBlockKeyMR(raw)
+		if err != nil {
+			reasons = append(reasons, err.Error())
+		} else {
+			if keyMR != ref.KeyMR {
+				reasons = append(reasons, fmt.Sprintf("Entry block hashes to %v", keyMR))
+			}
+			if fmt.Sprintf("%x", raw[:32]) != ref.ChainID {
+				reasons = append(reasons, fmt.Sprintf("Entry block header belongs to chain %x", raw[:32]))
+			}
+		}
+		for _, e := range block.EntryList {
+			data, err := hex.DecodeString(e.BinaryString)
+			if err != nil {
+				return nil, err
+			}
+			hash := fmt.Sprintf("%x", ComputeEntryHash(data))
+			if hash != e.Hash {
+				reasons = append(reasons, fmt.Sprintf("Entry %v hashes to %v", e.Hash, hash))
+			}
+		}
+	}
+
+	//A block saved by an interrupted sync is already the head of its chain
+	existing, err := LoadBlock(ref.KeyMR)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return reasons, nil
+	}
+	head, err := LoadChainHead(ref.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	if head == "" {
+		return reasons, nil
+	}
+	headBlock, err := LoadBlock(head)
+	if err != nil {
+		return nil, err
+	}
+	if headBlock == nil {
+		return reasons, nil
+	}
+	//A block refetched by the database check sits below the head
+	if headBlock.DBlockHeight > height {
+		if IsHashZeroes(block.PrevBlockHash) == false {
+			prev, err := LoadBlock(block.PrevBlockHash)
+			if err != nil {
+				return nil, err
+			}
+			if prev == nil {
+				reasons = append(reasons, fmt.Sprintf("Previous block %v is missing", block.PrevBlockHash))
+			}
+		}
+		return reasons, nil
+	}
+	if block.PrevBlockHash != headBlock.PartialHash && block.PrevBlockHash != headBlock.FullHash {
+		reasons = append(reasons, fmt.Sprintf("Previous block %v is not the head of the chain, %v", block.PrevBlockHash, head))
+	}
+	return reasons, nil
+}
+
+// QuarantineBlocks stores the blocks of a DBlock that failed verification,
+// keeping the first record of blocks that failed before, and halts the
+// synchronization at that DBlock.
+func QuarantineBlocks(dBlockKeyMR string, blocks []*QuarantinedBlock, ds *DataStatusStruct) error {
+	for _, v := range blocks {
+		key := v.DBlockKeyMR + v.Hash
+		existing, err := LoadData(QuarantineBucket, key, new(QuarantinedBlock))
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+		err = SaveData(QuarantineBucket, key, v)
+		if err != nil {
+			return err
+		}
+		ds.Quarantined++
+	}
+	ds.HaltedAt = dBlockKeyMR
+	return SaveDataStatus(ds)
+}
+
+func LoadQuarantinedBlocks() ([]*QuarantinedBlock, error) {
+	keys, err := LoadKeys(QuarantineBucket)
+	if err != nil {
+		return nil, err
+	}
+	answer := []*QuarantinedBlock{}
+	for _, v := range keys {
+		q := new(QuarantinedBlock)
+		q2, err := LoadData(QuarantineBucket, v, q)
+		if err != nil {
+			return nil, err
+		}
+		if q2 == nil {
+			continue
+		}
+		answer = append(answer, q)
+	}
+	return answer, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testEBlock(chainID, prev []byte, entryData ...[]byte) *Block {
+	header := append(append([]byte{}, chainID...), bytes.Repeat([]byte{0x33}, EBlockHeaderSize-32)...)
+	copy(header[64:96], prev)
+	raw := header
+	block := new(Block)
+	for _, v := range entryData {
+		entry := new(Entry)
+		entry.Hash = fmt.Sprintf("%x", ComputeEntryHash(v))
+		entry.BinaryString = fmt.Sprintf("%x", v)
+		block.EntryList = append(block.EntryList, entry)
+		raw = append(raw, ComputeEntryHash(v)...)
+	}
+	keyMR, _ := ComputeEBlockKeyMR(raw)
+	block.ChainID = fmt.Sprintf("%x", chainID)
+	block.PartialHash = keyMR
+	block.FullHash = "f" + keyMR
+	block.PrevBlockHash = fmt.Sprintf("%x", prev)
+	block.BinaryString = fmt.Sprintf("%x", raw)
+	block.IsEntryBlock = true
+	return block
+}
+
+func testDBlock(prev string, height int, blocks ...*Block) *DBlock {
+	raw := bytes.Repeat([]byte{0x55}, DBlockHeaderSize)
+	raw[0] = byte(height)
+	body := new(DBlock)
+	for _, v := range blocks {
+		pair, _ := hex.DecodeString(v.ChainID + v.PartialHash)
+		raw = append(raw, pair...)
+		body.EntryBlockList = append(body.EntryBlockList, ListEntry{ChainID: v.ChainID, KeyMR: v.PartialHash})
+	}
+	body.KeyMR, _ = ComputeDBlockKeyMR(raw)
+	body.BinaryString = fmt.Sprintf("%x", raw)
+	body.PrevBlockKeyMR = prev
+	body.SequenceNumber = height
+	return body
+}
+
+func TestVerifyDBlock(t *testing.T) {
+	resetTestData(NewFixtureClient())
+	defer initTestDatabase(t)()
+
+	chainID := bytes.Repeat([]byte{0x11}, 32)
+	first := testEBlock(chainID, make([]byte, 32), []byte{0x00, 0x01})
+	first0 := testDBlock(zeroHash, 0, first)
+
+	quarantined, err := VerifyDBlock(first0, []*Block{first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 0 {
+		t.Errorf("Valid DBlock failed verification - %v", quarantined[0].Reasons)
+	}
+	err = SaveBlock(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveChainHead(first.ChainID, first.PartialHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveDBlock(first0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The second block skips the first one and carries an entry that does not match its hash
+	second := testEBlock(chainID, make([]byte, 32), []byte{0x00, 0x02}, []byte{0x00, 0x03})
+	second.EntryList[1].BinaryString = "0004"
+	body := testDBlock("dx", 1, second)
+
+	quarantined, err = VerifyDBlock(body, []*Block{second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 2 {
+		t.Fatalf("Wrong number of quarantined blocks - %v", len(quarantined))
+	}
+	if quarantined[0].Hash != body.KeyMR || len(quarantined[0].Reasons) != 1 {
+		t.Errorf("Wrong DBlock verification - %v", quarantined[0])
+	}
+	if quarantined[1].Hash != second.PartialHash || len(quarantined[1].Reasons) != 2 {
+		t.Errorf("Wrong block verification - %v", quarantined[1].Reasons)
+	}
+
+	//A block that does not hash to the KeyMR it is referenced by
+	body = testDBlock(first0.KeyMR, 1, first)
+	quarantined, err = VerifyDBlock(body, []*Block{testEBlock(chainID, []byte(first.PartialHash), []byte{0x00, 0x05})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 1 || len(quarantined[0].Reasons) < 2 {
+		t.Errorf("Wrong KeyMR verification - %v", quarantined)
+	}
+
+	//A DBlock that does not hash to its KeyMR, or does not list the blocks we fetched
+	third := testEBlock(chainID, []byte(first.PartialHash), []byte{0x00, 0x06})
+	body = testDBlock(first0.KeyMR, 1, third)
+	body.KeyMR = "d1"
+	body.EntryBlockList[0].KeyMR = first.PartialHash
+	blocks, err := VerifyDBlock(body, []*Block{third})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) == 0 || blocks[0].Hash != "d1" || len(blocks[0].Reasons) != 2 {
+		t.Errorf("Wrong DBlock KeyMR verification - %v", blocks)
+	}
+
+	//A block refetched below the head of its chain links back to a stored block
+	third.DBlockHeight = 2
+	err = SaveBlock(third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveChainHead(third.ChainID, third.PartialHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstHash, _ := hex.DecodeString(first.PartialHash)
+	missing := testEBlock(chainID, firstHash, []byte{0x00, 0x07})
+	body = testDBlock(first0.KeyMR, 1, missing)
+	blocks, err = VerifyDBlock(body, []*Block{missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 0 {
+		t.Errorf("Block below the head failed verification - %v", blocks[0].Reasons)
+	}
+	unlinked := testEBlock(chainID, bytes.Repeat([]byte{0x22}, 32), []byte{0x00, 0x08})
+	body = testDBlock(first0.KeyMR, 1, unlinked)
+	blocks, err = VerifyDBlock(body, []*Block{unlinked})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || len(blocks[0].Reasons) != 1 {
+		t.Errorf("Wrong verification below the head - %v", blocks)
+	}
+
+	ds := LoadDataStatus()
+	err = QuarantineBlocks(quarantined[0].DBlockKeyMR, quarantined, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Quarantined != 1 {
+		t.Errorf("Quarantined block not counted - %v", ds.Quarantined)
+	}
+	if ds.HaltedAt != quarantined[0].DBlockKeyMR {
+		t.Errorf("Synchronization not halted - %v", ds.HaltedAt)
+	}
+
+	//A block failing again is not recorded twice
+	again := *quarantined[0]
+	again.Time = again.Time.Add(time.Hour)
+	err = QuarantineBlocks(again.DBlockKeyMR, []*QuarantinedBlock{&again}, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := LoadQuarantinedBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Quarantined != 1 || len(stored) != 1 || stored[0].Time.Equal(quarantined[0].Time) == false {
+		t.Errorf("Quarantined block recorded twice - %v, %v", ds.Quarantined, stored)
+	}
+}